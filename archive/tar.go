@@ -81,7 +81,7 @@ func UnTar(srcFile string, destDir string) (path string, err error) {
 	file, err := os.Open(srcFile)
 	if err != nil {
 		// tar归档结束
-		log.Error("打开压缩文件失败", "err", err.Error())
+		log.Error("打开压缩文件失败", log.ZapError(err))
 		return
 	}
 	defer file.Close()
@@ -89,7 +89,7 @@ func UnTar(srcFile string, destDir string) (path string, err error) {
 	if strings.HasSuffix(srcFile, "tar.gz") {
 		gr, err := gzip.NewReader(file)
 		if err != nil {
-			log.Error("打开压缩文件失败", "err", err.Error())
+			log.Error("打开压缩文件失败", log.ZapError(err))
 			return "", err
 		}
 		reader = gr
@@ -101,7 +101,7 @@ func UnTar(srcFile string, destDir string) (path string, err error) {
 	for {
 		tarHeader, err := tarReader.Next()
 		if err != nil && err != io.EOF {
-			log.Error("打开压缩文件失败", "err", err.Error())
+			log.Error("打开压缩文件失败", log.ZapError(err))
 			return "", err
 		}
 		if err == io.EOF {
@@ -114,7 +114,7 @@ func UnTar(srcFile string, destDir string) (path string, err error) {
 		if tarHeader.FileInfo().IsDir() {
 			err := os.MkdirAll(fpath, os.ModePerm)
 			if err != nil {
-				log.Error("创建解压目录失败", "err", err.Error())
+				log.Error("创建解压目录失败", log.ZapError(err))
 				return "", err
 			}
 			continue
@@ -122,11 +122,11 @@ func UnTar(srcFile string, destDir string) (path string, err error) {
 
 		file, err := os.Create(fpath)
 		if err != nil {
-			log.Error("创建文件失败", "name", fpath)
+			log.Error("创建文件失败", log.String("name", fpath))
 			return "", err
 		}
 		if _, err := io.Copy(file, tarReader); err != nil {
-			log.Error("向文件写入数据失败", "name", fpath)
+			log.Error("向文件写入数据失败", log.String("name", fpath))
 			return "", err
 		}
 		file.Close()
@@ -135,7 +135,7 @@ func UnTar(srcFile string, destDir string) (path string, err error) {
 	fileName := filepath.Base(srcFile)
 	fileName = strings.TrimSuffix(fileName, ".gz") // 去除扩展名后的文件名
 	fileName = strings.TrimSuffix(fileName, ".tar")
-	log.Info("文件名", "srcFile", srcFile, "fileName", fileName, "destDir", destDir)
+	log.Info("文件名", log.String("srcFile", srcFile), log.String("fileName", fileName), log.String("destDir", destDir))
 	path = fmt.Sprintf("%s%s/", destDir, fileName)
 	return
 }
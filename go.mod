@@ -8,5 +8,7 @@ require (
 	github.com/smartystreets/goconvey v1.6.4
 	github.com/sony/sonyflake v1.0.0
 	go.uber.org/zap v1.16.0
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,345 @@
+package hook
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	xhttp "github.com/HiData-xyz/hit/http"
+	"github.com/HiData-xyz/hit/log"
+	"github.com/HiData-xyz/hit/metrics"
+	"github.com/HiData-xyz/hit/pool"
+	"github.com/HiData-xyz/hit/trace"
+)
+
+// 回调投递的结果, 用于指标
+const (
+	resultSuccess = "success" // 投递成功
+	resultRetry   = "retry"   // 投递失败, 等待重试
+	resultDead    = "dead"    // 重试耗尽, 移入死信
+	resultFailed  = "failed"  // Do 重试耗尽
+)
+
+// 回调内置的指标
+var (
+	deliveriesTotal  = metrics.NewCounter("hit_hook_deliveries_total", "按结果统计的回调投递次数", "result")
+	deliveryDuration = metrics.NewHistogram("hit_hook_delivery_duration_seconds", "单次回调投递的耗时", metrics.DefBuckets)
+)
+
+// dispatcherSeq Dispatcher 的序号, 用于区分协程池的指标
+var dispatcherSeq int32
+
+// Sender 投递回调, 返回错误时按退避策略重试
+type Sender func(h *Hook) error
+
+// Callback 回调投递完成后调用, err 为空表示投递成功, 否则表示重试耗尽
+// 后台投递的回调重试耗尽后移入死信, Do 投递的回调不写入 outbox
+type Callback func(h *Hook, err error)
+
+// Dispatcher 后台投递 outbox 中的回调, 回调在独立的协程池中执行
+type Dispatcher struct {
+	outbox  *Outbox
+	send    Sender
+	pool    *pool.Pool
+	ownPool bool // pool 是否由 Dispatcher 创建, 关闭时一同关闭
+
+	MaxAttempts int           // 最大投递次数, 超过后移入死信
+	BaseDelay   time.Duration // 首次重试的等待时间
+	MaxDelay    time.Duration // 重试等待时间上限
+	Interval    time.Duration // 扫描 outbox 的时间间隔
+
+	notify   chan struct{}
+	rand     *rand.Rand
+	secrets  []string            // 签名密钥
+	callback Callback            // 投递完成回调
+	inflight map[string]struct{} // 正在投递的回调
+	m        sync.Mutex          // 守护 rand、secrets、callback、inflight
+}
+
+// NewDispatcher 返回投递 outbox 中回调的 Dispatcher, send 为空时使用 Send
+// 默认的协程池在指标中名为 hook-序号, 替换 Dispatcher 时不影响新的协程池的指标
+func NewDispatcher(o *Outbox, send Sender) *Dispatcher {
+	if send == nil {
+		send = Send
+	}
+	return &Dispatcher{
+		outbox:      o,
+		send:        send,
+		pool:        pool.NewPool(16, 1024).SetName("hook-" + strconv.Itoa(int(atomic.AddInt32(&dispatcherSeq, 1)))),
+		ownPool:     true,
+		MaxAttempts: 8,
+		BaseDelay:   time.Second,
+		MaxDelay:    10 * time.Minute,
+		Interval:    time.Second,
+		notify:      make(chan struct{}, 1),
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		inflight:    make(map[string]struct{}),
+	}
+}
+
+// Outbox 返回使用的 outbox
+func (d *Dispatcher) Outbox() *Outbox {
+	return d.outbox
+}
+
+// SetPool 设置执行回调的协程池, 需要在 Run 之前调用
+// 默认的协程池随之关闭, p 由调用方关闭
+func (d *Dispatcher) SetPool(p *pool.Pool) {
+	if d.ownPool {
+		d.pool.Close()
+	}
+	d.pool = p
+	d.ownPool = false
+}
+
+// Close 关闭 outbox 和默认的协程池, 需要在 Run 结束后调用
+func (d *Dispatcher) Close() error {
+	if d.ownPool {
+		d.pool.Close()
+	}
+	return d.outbox.Close()
+}
+
+// OnComplete 设置投递完成回调
+func (d *Dispatcher) OnComplete(cb Callback) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.callback = cb
+}
+
+// Enqueue 将回调写入 outbox 并唤醒投递
+func (d *Dispatcher) Enqueue(h *Hook) error {
+	if err := d.outbox.Add(h); err != nil {
+		return err
+	}
+	d.Notify()
+	return nil
+}
+
+// Do 立即投递回调, 失败时按退避策略重试, 不写入 outbox
+// 投递成功或重试耗尽时调用 OnComplete 设置的回调
+func (d *Dispatcher) Do(h *Hook) (err error) {
+	h = h.clone()
+	for {
+		h.Attempts++
+		err = d.attempt(h)
+		if err == nil {
+			deliveriesTotal.Inc(resultSuccess)
+			d.complete(h, nil)
+			return
+		}
+		if h.Attempts >= d.maxAttempts(h) {
+			h.LastError = err.Error()
+			deliveriesTotal.Inc(resultFailed)
+			d.complete(h, err)
+			return
+		}
+		deliveriesTotal.Inc(resultRetry)
+		time.Sleep(d.backoff(h.Attempts))
+	}
+}
+
+// Replay 重新投递死信
+func (d *Dispatcher) Replay(id string) error {
+	if err := d.outbox.Replay(id); err != nil {
+		return err
+	}
+	d.Notify()
+	return nil
+}
+
+// SetSecrets 设置签名密钥, 投递时在 SignatureHeader 请求头中携带签名
+// 轮换密钥期间可同时设置新旧密钥, 为空时不签名
+func (d *Dispatcher) SetSecrets(secrets ...string) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.secrets = append([]string(nil), secrets...)
+}
+
+// attempt 投递一次回调, 每次投递是创建回调的请求的子 Span
+func (d *Dispatcher) attempt(h *Hook) (err error) {
+	c := context.Background()
+	if sc, ok := trace.Extract(h.Header); ok {
+		c = trace.ContextWithRemote(c, sc)
+	}
+	_, span := trace.Start(c, "hook "+h.Method, trace.KindClient)
+	span.SetAttribute("hook.id", h.ID)
+	span.SetAttribute("hook.url", h.URL)
+	span.SetAttribute("hook.attempts", h.Attempts)
+	start := time.Now()
+	defer func() {
+		deliveryDuration.ObserveSince(start)
+		span.SetError(err)
+		span.End()
+	}()
+
+	_h := h.clone()
+	trace.Inject(_h.Header, span.Context())
+	return d.send(d.sign(_h))
+}
+
+// sign 返回携带签名的副本, 每次投递使用新的时间戳
+func (d *Dispatcher) sign(h *Hook) *Hook {
+	d.m.Lock()
+	secrets := d.secrets
+	d.m.Unlock()
+	if len(secrets) == 0 {
+		return h
+	}
+
+	_h := h.clone()
+	_h.Header.Set(SignatureHeader, Signature(time.Now(), h.Body, secrets...))
+	return _h
+}
+
+// Notify 唤醒投递, 不阻塞
+func (d *Dispatcher) Notify() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run 持续投递回调, 直到 ctx 结束, 结束时关闭默认的协程池
+func (d *Dispatcher) Run(ctx context.Context) {
+	if d.ownPool {
+		defer d.pool.Close()
+	}
+
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		d.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.notify:
+		}
+	}
+}
+
+// dispatch 将所有到期的回调放入协程池投递
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	for _, h := range d.outbox.Due(time.Now()) {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if !d.acquire(h.ID) {
+			continue
+		}
+
+		h := h
+		err := d.pool.Push(func() {
+			defer d.release(h.ID)
+			d.deliver(h)
+		})
+		if err != nil {
+			// 协程池繁忙, 等待下次扫描
+			d.release(h.ID)
+			logger(h).Error("回调投递繁忙", log.String("id", h.ID), log.ZapError(err))
+			return
+		}
+	}
+}
+
+// acquire 标记回调正在投递, 避免重复投递
+func (d *Dispatcher) acquire(id string) bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if _, ok := d.inflight[id]; ok {
+		return false
+	}
+	d.inflight[id] = struct{}{}
+	return true
+}
+
+func (d *Dispatcher) release(id string) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	delete(d.inflight, id)
+}
+
+// maxAttempts 回调的最大投递次数
+func (d *Dispatcher) maxAttempts(h *Hook) int {
+	if h.MaxAttempts > 0 {
+		return h.MaxAttempts
+	}
+	return d.MaxAttempts
+}
+
+// deliver 投递一个回调并记录结果
+func (d *Dispatcher) deliver(h *Hook) {
+	h.Attempts++
+	err := d.attempt(h)
+	if err == nil {
+		deliveriesTotal.Inc(resultSuccess)
+		if err := d.outbox.Done(h.ID); err != nil {
+			logger(h).Error("记录回调状态失败", log.String("id", h.ID), log.ZapError(err))
+		}
+		logger(h).Info("回调成功", log.String("id", h.ID), log.String("url", h.URL), log.Int("attempts", h.Attempts))
+		d.complete(h, nil)
+		return
+	}
+
+	h.LastError = err.Error()
+	if h.Attempts >= d.maxAttempts(h) {
+		deliveriesTotal.Inc(resultDead)
+		logger(h).Error("回调失败, 移入死信", log.String("id", h.ID), log.String("url", h.URL), log.Int("attempts", h.Attempts), log.ZapError(err))
+		if err := d.outbox.Dead(h); err != nil {
+			logger(h).Error("记录回调状态失败", log.String("id", h.ID), log.ZapError(err))
+		}
+		d.complete(h, err)
+		return
+	}
+
+	deliveriesTotal.Inc(resultRetry)
+	delay := d.backoff(h.Attempts)
+	logger(h).Info("回调失败, 等待重试", log.String("id", h.ID), log.String("url", h.URL), log.Int("attempts", h.Attempts), log.Duration("delay", delay), log.ZapError(err))
+	if err := d.outbox.Retry(h, time.Now().Add(delay)); err != nil {
+		logger(h).Error("记录回调状态失败", log.String("id", h.ID), log.ZapError(err))
+	}
+}
+
+// logger 返回带有回调请求ID的日志
+func logger(h *Hook) log.Logger {
+	if id := h.Header.Get(xhttp.RequestIDHeader); id != "" {
+		return log.With(log.String(log.RequestIDKey, id))
+	}
+	return log.With()
+}
+
+// complete 调用投递完成回调
+func (d *Dispatcher) complete(h *Hook, err error) {
+	d.m.Lock()
+	cb := d.callback
+	d.m.Unlock()
+	if cb != nil {
+		cb(h, err)
+	}
+}
+
+// backoff 计算第 attempts 次失败后的等待时间
+// 等待时间按 BaseDelay*2^(attempts-1) 增长, 不超过 MaxDelay, 并在 [d/2, d) 之间随机抖动
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+	return time.Duration(half + d.rand.Int63n(half))
+}
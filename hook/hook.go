@@ -0,0 +1,160 @@
+// Package hook 实现可靠的HTTP回调投递
+//
+// 回调先追加写入本地 outbox 文件, 再由后台 Dispatcher 投递,
+// 失败后按指数退避加随机抖动重试, 超过最大重试次数后移入死信文件,
+// 死信可以查看并重新投递. 进程重启后, 未投递完成的回调会从 outbox 文件恢复.
+package hook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	xhttp "github.com/HiData-xyz/hit/http"
+
+	"github.com/HiData-xyz/hit/util"
+)
+
+// Hook 回调请求
+type Hook struct {
+	ID        string      `json:"id"`
+	Method    string      `json:"method"`
+	URL       string      `json:"url"`
+	Header    http.Header `json:"header,omitempty"`
+	Body      []byte      `json:"body,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+
+	Timeout     time.Duration `json:"timeout,omitempty"`      // 单次投递超时时间, 为 0 时使用客户端默认值
+	MaxAttempts int           `json:"max_attempts,omitempty"` // 最大投递次数, 为 0 时使用 Dispatcher 的配置
+	Expect      []int         `json:"expect,omitempty"`       // 视为成功的HTTP状态码, 为空时为 2xx
+
+	Attempts  int       `json:"attempts"`             // 已投递次数
+	NextAt    time.Time `json:"next_at"`              // 下次投递时间
+	LastError string    `json:"last_error,omitempty"` // 最近一次投递失败的原因
+}
+
+// New 返回一个回调请求
+func New(method, url string, body []byte, opts ...OptionFunc) *Hook {
+	now := time.Now()
+	h := &Hook{
+		ID:        util.UUID(),
+		Method:    method,
+		URL:       url,
+		Header:    make(http.Header),
+		Body:      body,
+		CreatedAt: now,
+		NextAt:    now,
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+// OptionFunc 回调请求配置
+type OptionFunc func(h *Hook)
+
+// Method 设置请求方法
+func Method(method string) OptionFunc {
+	return func(h *Hook) {
+		h.Method = method
+	}
+}
+
+// Header 设置请求头
+func Header(key, val string) OptionFunc {
+	return func(h *Hook) {
+		h.Header.Set(key, val)
+	}
+}
+
+// Timeout 设置单次投递超时时间
+func Timeout(d time.Duration) OptionFunc {
+	return func(h *Hook) {
+		h.Timeout = d
+	}
+}
+
+// Retries 设置失败后的重试次数
+func Retries(n int) OptionFunc {
+	return func(h *Hook) {
+		h.MaxAttempts = n + 1
+	}
+}
+
+// Expect 设置视为成功的HTTP状态码
+func Expect(codes ...int) OptionFunc {
+	return func(h *Hook) {
+		h.Expect = codes
+	}
+}
+
+// StatusError 返回的HTTP状态码不符合预期
+type StatusError struct {
+	Code int
+	Body string
+}
+
+// Error 实现 error 接口
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.Code, e.Body)
+}
+
+// Send 默认的投递方法, 使用 http 包的客户端发送一次请求, 并校验返回的状态码
+func Send(h *Hook) error {
+	req, err := h.Request()
+	if err != nil {
+		return err
+	}
+	if h.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), h.Timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	code, data, err := xhttp.Send(req)
+	if err != nil {
+		return err
+	}
+	if !h.expect(code) {
+		return &StatusError{Code: code, Body: string(data)}
+	}
+	return nil
+}
+
+// expect 状态码是否符合预期
+func (h *Hook) expect(code int) bool {
+	if len(h.Expect) == 0 {
+		return 200 <= code && code <= 299
+	}
+	for _, c := range h.Expect {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Request 构建HTTP请求
+func (h *Hook) Request() (*http.Request, error) {
+	req, err := http.NewRequest(h.Method, h.URL, bytes.NewReader(h.Body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	return req, nil
+}
+
+// clone 返回副本, 避免调用方修改 outbox 中的状态
+func (h *Hook) clone() *Hook {
+	_h := *h
+	_h.Header = h.Header.Clone()
+	if _h.Header == nil {
+		_h.Header = make(http.Header)
+	}
+	return &_h
+}
@@ -0,0 +1,208 @@
+package hook_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HiData-xyz/hit/hook"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOutbox(t *testing.T) {
+	Convey("测试outbox持久化", t, func() {
+		dir := t.TempDir()
+		o, err := hook.Open(dir)
+		So(err, ShouldBeNil)
+
+		a := hook.New(http.MethodPost, "http://127.0.0.1/a", []byte(`{"a":1}`))
+		b := hook.New(http.MethodPost, "http://127.0.0.1/b", nil)
+		c := hook.New(http.MethodPost, "http://127.0.0.1/c", nil)
+		So(o.Add(a), ShouldBeNil)
+		So(o.Add(b), ShouldBeNil)
+		So(o.Add(c), ShouldBeNil)
+		So(o.Done(a.ID), ShouldBeNil)
+		So(o.Retry(b, time.Now().Add(time.Hour)), ShouldBeNil)
+		So(o.Dead(c), ShouldBeNil)
+		So(o.Close(), ShouldBeNil)
+
+		Convey("重新打开后恢复待投递的回调和死信", func() {
+			o, err := hook.Open(dir)
+			So(err, ShouldBeNil)
+			defer o.Close()
+
+			pending := o.Pending()
+			So(pending, ShouldHaveLength, 1)
+			So(pending[0].ID, ShouldEqual, b.ID)
+			So(o.Due(time.Now()), ShouldBeEmpty)
+
+			dead := o.DeadLetters()
+			So(dead, ShouldHaveLength, 1)
+			So(dead[0].ID, ShouldEqual, c.ID)
+
+			Convey("重新投递死信", func() {
+				So(o.Replay(c.ID), ShouldBeNil)
+				So(o.DeadLetters(), ShouldBeEmpty)
+				So(o.Due(time.Now()), ShouldHaveLength, 1)
+				So(o.Replay(c.ID), ShouldEqual, hook.ErrHookNotFound)
+			})
+		})
+	})
+}
+
+func TestDispatcher(t *testing.T) {
+	Convey("测试回调投递", t, func() {
+		o, err := hook.Open(t.TempDir())
+		So(err, ShouldBeNil)
+		defer o.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		Convey("失败后重试直至成功", func() {
+			var calls int32
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer svr.Close()
+
+			d := hook.NewDispatcher(o, nil)
+			d.BaseDelay = time.Millisecond
+			d.MaxDelay = 5 * time.Millisecond
+			d.Interval = time.Millisecond
+			go d.Run(ctx)
+
+			So(d.Enqueue(hook.New(http.MethodPost, svr.URL, nil)), ShouldBeNil)
+			So(waitFor(func() bool { return len(o.Pending()) == 0 }), ShouldBeTrue)
+			So(atomic.LoadInt32(&calls), ShouldEqual, 3)
+			So(o.DeadLetters(), ShouldBeEmpty)
+		})
+
+		Convey("超过最大投递次数后移入死信", func() {
+			d := hook.NewDispatcher(o, func(h *hook.Hook) error {
+				return errors.New("refused")
+			})
+			d.MaxAttempts = 2
+			d.BaseDelay = time.Millisecond
+			d.Interval = time.Millisecond
+			go d.Run(ctx)
+
+			So(d.Enqueue(hook.New(http.MethodPost, "http://127.0.0.1/", nil)), ShouldBeNil)
+			So(waitFor(func() bool { return len(o.DeadLetters()) == 1 }), ShouldBeTrue)
+			dead := o.DeadLetters()[0]
+			So(dead.Attempts, ShouldEqual, 2)
+			So(dead.LastError, ShouldEqual, "refused")
+		})
+	})
+}
+
+func waitFor(fn func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if fn() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return fn()
+}
+
+func TestSignature(t *testing.T) {
+	Convey("测试回调签名", t, func() {
+		now := time.Now()
+		body := []byte(`{"id":1}`)
+		header := hook.Signature(now, body, "new", "old")
+
+		So(hook.Verify(header, body, now, time.Minute, "new"), ShouldBeNil)
+		So(hook.Verify(header, body, now, time.Minute, "old"), ShouldBeNil)
+		So(hook.Verify(header, body, now, time.Minute, "other"), ShouldEqual, hook.ErrSignatureInvalid)
+		So(hook.Verify(header, []byte(`{"id":2}`), now, time.Minute, "new"), ShouldEqual, hook.ErrSignatureInvalid)
+		So(hook.Verify(header, body, now.Add(2*time.Minute), time.Minute, "new"), ShouldEqual, hook.ErrSignatureExpired)
+		So(hook.Verify("", body, now, time.Minute, "new"), ShouldEqual, hook.ErrSignatureMissing)
+		So(hook.Verify("t=abc,v1=00", body, now, time.Minute, "new"), ShouldEqual, hook.ErrSignatureInvalid)
+	})
+}
+
+func TestHookOptions(t *testing.T) {
+	Convey("测试回调请求配置", t, func() {
+		var method, header string
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, header = r.Method, r.Header.Get("X-Test")
+			if r.URL.Path == "/slow" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer svr.Close()
+
+		Convey("请求方法和请求头", func() {
+			h := hook.New(http.MethodPost, svr.URL, nil, hook.Method(http.MethodPut), hook.Header("X-Test", "1"))
+			So(hook.Send(h), ShouldBeNil)
+			So(method, ShouldEqual, http.MethodPut)
+			So(header, ShouldEqual, "1")
+		})
+
+		Convey("视为成功的状态码", func() {
+			So(hook.Send(hook.New(http.MethodPost, svr.URL, nil, hook.Expect(http.StatusAccepted))), ShouldBeNil)
+			err := hook.Send(hook.New(http.MethodPost, svr.URL, nil, hook.Expect(http.StatusOK)))
+			So(err, ShouldHaveSameTypeAs, &hook.StatusError{})
+		})
+
+		Convey("超时时间", func() {
+			So(hook.Send(hook.New(http.MethodPost, svr.URL+"/slow", nil, hook.Timeout(10*time.Millisecond))), ShouldNotBeNil)
+		})
+
+		Convey("立即投递, 失败时重试", func() {
+			o, _ := hook.Open("")
+			d := hook.NewDispatcher(o, nil)
+			defer d.Close()
+			d.BaseDelay = time.Millisecond
+			var results []error
+			var attempts []int
+			d.OnComplete(func(h *hook.Hook, err error) {
+				results = append(results, err)
+				attempts = append(attempts, h.Attempts)
+			})
+			So(d.Do(hook.New(http.MethodPost, svr.URL, nil)), ShouldBeNil)
+			So(d.Do(hook.New(http.MethodPost, svr.URL, nil, hook.Expect(http.StatusOK), hook.Retries(2))), ShouldNotBeNil)
+			So(o.Pending(), ShouldBeEmpty)
+			So(o.DeadLetters(), ShouldBeEmpty)
+			So(results, ShouldHaveLength, 2)
+			So(results[0], ShouldBeNil)
+			So(results[1], ShouldNotBeNil)
+			So(attempts, ShouldResemble, []int{1, 3})
+		})
+
+		Convey("重试次数和投递完成回调", func() {
+			o, _ := hook.Open("")
+			d := hook.NewDispatcher(o, nil)
+			d.BaseDelay = time.Millisecond
+			d.Interval = time.Millisecond
+			done := make(chan error, 2)
+			d.OnComplete(func(h *hook.Hook, err error) {
+				done <- err
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go d.Run(ctx)
+
+			So(d.Enqueue(hook.New(http.MethodPost, svr.URL, nil)), ShouldBeNil)
+			So(<-done, ShouldBeNil)
+
+			So(d.Enqueue(hook.New(http.MethodPost, svr.URL, nil, hook.Expect(http.StatusOK), hook.Retries(1))), ShouldBeNil)
+			So(<-done, ShouldNotBeNil)
+			dead := o.DeadLetters()
+			So(dead, ShouldHaveLength, 1)
+			So(dead[0].Attempts, ShouldEqual, 2)
+		})
+	})
+}
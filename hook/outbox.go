@@ -0,0 +1,386 @@
+package hook
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 常用错误
+var (
+	ErrOutboxClosed = errors.New("outbox已关闭")
+	ErrHookNotFound = errors.New("回调不存在")
+)
+
+// outbox 文件中的操作类型
+const (
+	opAdd   = "add"   // 新增回调
+	opRetry = "retry" // 投递失败, 等待重试
+	opDone  = "done"  // 投递成功
+	opDead  = "dead"  // 移入死信
+)
+
+const (
+	outboxFile = "outbox.log"
+	deadFile   = "dead.log"
+
+	// compactRecords 记录数超过待投递回调数量的该倍数时压缩 outbox 文件
+	compactRecords = 4
+	// minCompactRecords 记录数较少时不压缩
+	minCompactRecords = 1024
+)
+
+// record outbox 文件中的一条记录, 每行一条 JSON
+type record struct {
+	Op   string `json:"op"`
+	Hook *Hook  `json:"hook"`
+}
+
+// Outbox 只追加写入的回调存储
+// 每次状态变化追加一条记录, 打开时按顺序重放记录恢复待投递的回调,
+// 记录过多时改写为只包含待投递回调的新文件.
+// dir 为空时只保存在内存中.
+type Outbox struct {
+	m sync.Mutex
+
+	dir     string
+	file    *os.File
+	records int // outbox 文件中的记录数
+	closed  bool
+
+	pending map[string]*Hook // 待投递的回调
+	dead    []*Hook          // 死信
+}
+
+// Open 打开 dir 目录下的 outbox, 目录不存在时自动创建
+func Open(dir string) (o *Outbox, err error) {
+	o = &Outbox{
+		dir:     dir,
+		pending: make(map[string]*Hook),
+	}
+	if dir == "" {
+		return o, nil
+	}
+
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err = o.load(); err != nil {
+		return nil, err
+	}
+	if err = o.compact(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// load 重放 outbox 和死信文件
+func (o *Outbox) load() error {
+	err := readRecords(filepath.Join(o.dir, outboxFile), func(rec *record) {
+		switch rec.Op {
+		case opAdd, opRetry:
+			o.pending[rec.Hook.ID] = rec.Hook
+		case opDone, opDead:
+			delete(o.pending, rec.Hook.ID)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return readRecords(filepath.Join(o.dir, deadFile), func(rec *record) {
+		o.dead = append(o.dead, rec.Hook)
+	})
+}
+
+// readRecords 逐行读取记录, 忽略进程崩溃时写入不完整的最后一行
+func readRecords(path string, fn func(rec *record)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			rec := new(record)
+			if json.Unmarshal(line, rec) == nil && rec.Hook != nil {
+				fn(rec)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeRecords 将记录写入临时文件后替换 path, 保证文件完整
+func writeRecords(path string, records []*record) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err = enc.Encode(rec); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// compact 改写 outbox 文件, 只保留待投递的回调
+func (o *Outbox) compact() (err error) {
+	if o.file != nil {
+		o.file.Close()
+		o.file = nil
+	}
+
+	records := make([]*record, 0, len(o.pending))
+	for _, h := range o.sorted() {
+		records = append(records, &record{Op: opAdd, Hook: h})
+	}
+	path := filepath.Join(o.dir, outboxFile)
+	if err = writeRecords(path, records); err != nil {
+		return
+	}
+	o.file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	o.records = len(records)
+	return
+}
+
+// append 追加一条记录并落盘
+func (o *Outbox) append(op string, h *Hook) error {
+	if o.file == nil {
+		return nil
+	}
+	b, err := json.Marshal(&record{Op: op, Hook: h})
+	if err != nil {
+		return err
+	}
+	if _, err = o.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err = o.file.Sync(); err != nil {
+		return err
+	}
+	o.records++
+	if o.records > minCompactRecords && o.records > compactRecords*len(o.pending) {
+		return o.compact()
+	}
+	return nil
+}
+
+// sorted 按创建时间返回待投递的回调
+func (o *Outbox) sorted() []*Hook {
+	hooks := make([]*Hook, 0, len(o.pending))
+	for _, h := range o.pending {
+		hooks = append(hooks, h)
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+	})
+	return hooks
+}
+
+// Add 新增回调, 返回时回调已写入磁盘
+func (o *Outbox) Add(h *Hook) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.closed {
+		return ErrOutboxClosed
+	}
+
+	h = h.clone()
+	if err := o.append(opAdd, h); err != nil {
+		return err
+	}
+	o.pending[h.ID] = h
+	return nil
+}
+
+// Due 返回到达投递时间的回调
+func (o *Outbox) Due(now time.Time) (hooks []*Hook) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	for _, h := range o.sorted() {
+		if !h.NextAt.After(now) {
+			hooks = append(hooks, h.clone())
+		}
+	}
+	return
+}
+
+// Pending 返回全部待投递的回调
+func (o *Outbox) Pending() (hooks []*Hook) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	for _, h := range o.sorted() {
+		hooks = append(hooks, h.clone())
+	}
+	return
+}
+
+// Retry 记录投递失败, 在 next 时间后重试
+func (o *Outbox) Retry(h *Hook, next time.Time) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if _, ok := o.pending[h.ID]; !ok {
+		return ErrHookNotFound
+	}
+
+	h = h.clone()
+	h.NextAt = next
+	if err := o.append(opRetry, h); err != nil {
+		return err
+	}
+	o.pending[h.ID] = h
+	return nil
+}
+
+// Done 记录投递成功
+func (o *Outbox) Done(id string) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	h, ok := o.pending[id]
+	if !ok {
+		return ErrHookNotFound
+	}
+
+	if err := o.append(opDone, &Hook{ID: h.ID}); err != nil {
+		return err
+	}
+	delete(o.pending, id)
+	return nil
+}
+
+// Dead 将重试次数耗尽的回调移入死信文件
+func (o *Outbox) Dead(h *Hook) (err error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if _, ok := o.pending[h.ID]; !ok {
+		return ErrHookNotFound
+	}
+
+	h = h.clone()
+	if o.dir != "" {
+		f, err := os.OpenFile(filepath.Join(o.dir, deadFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		err = json.NewEncoder(f).Encode(&record{Op: opDead, Hook: h})
+		if err == nil {
+			err = f.Sync()
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	o.dead = append(o.dead, h)
+
+	if err = o.append(opDead, &Hook{ID: h.ID}); err != nil {
+		return
+	}
+	delete(o.pending, h.ID)
+	return
+}
+
+// DeadLetters 返回全部死信
+func (o *Outbox) DeadLetters() (hooks []*Hook) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	for _, h := range o.dead {
+		hooks = append(hooks, h.clone())
+	}
+	return
+}
+
+// Replay 将死信重新放入 outbox, 重置投递次数
+func (o *Outbox) Replay(id string) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.closed {
+		return ErrOutboxClosed
+	}
+
+	index := -1
+	for i, h := range o.dead {
+		if h.ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ErrHookNotFound
+	}
+
+	h := o.dead[index].clone()
+	h.Attempts = 0
+	h.LastError = ""
+	h.NextAt = time.Now()
+	if err := o.append(opAdd, h); err != nil {
+		return err
+	}
+	o.pending[h.ID] = h
+
+	dead := make([]*Hook, 0, len(o.dead)-1)
+	dead = append(dead, o.dead[:index]...)
+	dead = append(dead, o.dead[index+1:]...)
+	o.dead = dead
+	if o.dir == "" {
+		return nil
+	}
+	records := make([]*record, 0, len(dead))
+	for _, h := range dead {
+		records = append(records, &record{Op: opDead, Hook: h})
+	}
+	return writeRecords(filepath.Join(o.dir, deadFile), records)
+}
+
+// Close 关闭 outbox
+func (o *Outbox) Close() error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	if o.file == nil {
+		return nil
+	}
+	return o.file.Close()
+}
@@ -0,0 +1,91 @@
+package hook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader 回调签名请求头
+// 格式: t=<unix 时间戳>,v1=<签名>[,v1=<签名>...], 轮换密钥期间每个密钥各生成一个签名
+const SignatureHeader = "X-Hit-Signature"
+
+// 签名校验错误
+var (
+	ErrSignatureMissing = errors.New("缺少签名")
+	ErrSignatureInvalid = errors.New("签名不正确")
+	ErrSignatureExpired = errors.New("签名已过期")
+)
+
+// Sign 计算签名: hex(HMAC-SHA256(secret, timestamp + "." + body))
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signature 使用全部密钥生成签名请求头的值
+func Signature(t time.Time, body []byte, secrets ...string) string {
+	timestamp := t.Unix()
+	var b strings.Builder
+	b.WriteString("t=")
+	b.WriteString(strconv.FormatInt(timestamp, 10))
+	for _, secret := range secrets {
+		b.WriteString(",v1=")
+		b.WriteString(Sign(secret, timestamp, body))
+	}
+	return b.String()
+}
+
+// Verify 校验签名请求头, 任一密钥校验通过即可
+// 时间戳与 now 相差超过 window 时视为重放请求, window 为 0 时不校验时间戳
+func Verify(header string, body []byte, now time.Time, window time.Duration, secrets ...string) error {
+	if header == "" {
+		return ErrSignatureMissing
+	}
+
+	var timestamp int64
+	var signs []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			t, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				return ErrSignatureInvalid
+			}
+			timestamp = t
+		case "v1":
+			signs = append(signs, kv[1])
+		}
+	}
+	if timestamp == 0 || len(signs) == 0 {
+		return ErrSignatureInvalid
+	}
+
+	if window > 0 {
+		diff := now.Sub(time.Unix(timestamp, 0))
+		if diff > window || diff < -window {
+			return ErrSignatureExpired
+		}
+	}
+
+	for _, secret := range secrets {
+		want := []byte(Sign(secret, timestamp, body))
+		for _, sign := range signs {
+			if hmac.Equal(want, []byte(sign)) {
+				return nil
+			}
+		}
+	}
+	return ErrSignatureInvalid
+}
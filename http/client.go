@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,21 +11,85 @@ import (
 	"mime/multipart"
 	xhttp "net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/HiData-xyz/hit/log"
+	"github.com/HiData-xyz/hit/metrics"
+	"github.com/HiData-xyz/hit/trace"
+	"github.com/HiData-xyz/hit/util"
+)
+
+// RequestIDHeader 传递请求ID的请求头
+const RequestIDHeader = "X-Request-ID"
+
+// IdempotencyHeader PostTimes 重试时携带的幂等键请求头
+const IdempotencyHeader = "Idempotency-Key"
+
+// http 客户端内置的指标, 网络错误时 code 为 error
+var (
+	clientRequests = metrics.NewCounter("hit_http_client_requests_total",
+		"按目标主机和状态码统计的请求次数", "method", "host", "code")
+	clientRetries = metrics.NewCounter("hit_http_client_retries_total",
+		"按目标主机统计的重试次数", "host")
+	clientDuration = metrics.NewHistogram("hit_http_client_request_duration_seconds",
+		"按目标主机统计的单次请求耗时", metrics.DefBuckets, "method", "host")
 )
 
 // Get 发送GET请求, 数据传输格式使用JSON
+// 不转发请求ID, 处理请求时使用 route.Context 的 Client().Get 转发当前请求的请求ID
 func Get(url string, res interface{}) (err error) {
-	log.Info("发送GET请求", "URL:", url)
-	return GetTimes(url, 3, res)
+	return GetContext(context.Background(), url, res)
 }
 
 // Post 发送POST请求, 数据传输格式使用JSON
+// 不转发请求ID, 处理请求时使用 route.Context 的 Client().Post 转发当前请求的请求ID
 func Post(url string, req, res interface{}) (err error) {
-	log.Info("发送POST请求", "URL:", url)
-	return PostTimes(url, 3, req, res)
+	return PostContext(context.Background(), url, req, res)
+}
+
+// GetContext 发送GET请求, ctx 中有请求ID时通过 RequestIDHeader 转发
+func GetContext(ctx context.Context, url string, res interface{}) (err error) {
+	log.Ctx(ctx).Info("发送GET请求", log.String("URL", url))
+	return GetTimesContext(ctx, url, 3, res)
+}
+
+// PostContext 发送POST请求, ctx 中有请求ID时通过 RequestIDHeader 转发
+func PostContext(ctx context.Context, url string, req, res interface{}) (err error) {
+	log.Ctx(ctx).Info("发送POST请求", log.String("URL", url))
+	return PostTimesContext(ctx, url, 3, req, res)
+}
+
+// Client 绑定 context 的客户端, 请求携带 context 中的请求ID和追踪上下文
+type Client struct {
+	ctx context.Context
+}
+
+// WithContext 返回绑定 ctx 的客户端
+func WithContext(ctx context.Context) *Client {
+	return &Client{ctx: ctx}
+}
+
+// Get 发送GET请求, 数据传输格式使用JSON
+func (c *Client) Get(url string, res interface{}) error {
+	return GetContext(c.ctx, url, res)
+}
+
+// Post 发送POST请求, 数据传输格式使用JSON
+func (c *Client) Post(url string, req, res interface{}) error {
+	return PostContext(c.ctx, url, req, res)
+}
+
+// GetTimes 发送GET请求, 数据传输格式使用JSON
+// times: 请求失败后重试次数
+func (c *Client) GetTimes(url string, times int, res interface{}) error {
+	return GetTimesContext(c.ctx, url, times, res)
+}
+
+// PostTimes 发送POST请求, 数据传输格式使用JSON
+// times: 请求失败后重试次数
+func (c *Client) PostTimes(url string, times int, req, res interface{}) error {
+	return PostTimesContext(c.ctx, url, times, req, res)
 }
 
 var defaultClient = xhttp.Client{
@@ -32,9 +97,16 @@ var defaultClient = xhttp.Client{
 }
 
 // GetTimes 发送GET请求, 数据传输格式使用JSON
+// 不转发请求ID, 处理请求时使用 route.Context 的 Client().GetTimes 转发当前请求的请求ID
 // times: 请求失败后重试次数
 func GetTimes(url string, times int, res interface{}) (err error) {
-	httpReq, err := xhttp.NewRequest(xhttp.MethodGet, url, nil)
+	return GetTimesContext(context.Background(), url, times, res)
+}
+
+// GetTimesContext 发送GET请求, 数据传输格式使用JSON
+// times: 请求失败后重试次数
+func GetTimesContext(ctx context.Context, url string, times int, res interface{}) (err error) {
+	httpReq, err := xhttp.NewRequestWithContext(ctx, xhttp.MethodGet, url, nil)
 	if err != nil {
 		return
 	}
@@ -47,19 +119,30 @@ func GetTimes(url string, times int, res interface{}) (err error) {
 }
 
 // PostTimes 发送POST请求, 数据传输格式使用JSON
+// 不转发请求ID, 处理请求时使用 route.Context 的 Client().PostTimes 转发当前请求的请求ID
 // times: 请求失败后重试次数
 func PostTimes(url string, times int, req, res interface{}) (err error) {
+	return PostTimesContext(context.Background(), url, times, req, res)
+}
+
+// PostTimesContext 发送POST请求, 数据传输格式使用JSON
+// times: 请求失败后重试次数
+func PostTimesContext(ctx context.Context, url string, times int, req, res interface{}) (err error) {
 	// 转化对象成json数据
 	reqBody, err := json.Marshal(req)
 	if err != nil {
 		return
 	}
 
-	httpReq, err := xhttp.NewRequest(xhttp.MethodPost, url, bytes.NewBuffer(reqBody))
+	httpReq, err := xhttp.NewRequestWithContext(ctx, xhttp.MethodPost, url, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	// 重试使用同一个幂等键, 服务端使用 route.Idempotency 时不会重复处理
+	if times > 1 {
+		httpReq.Header.Set(IdempotencyHeader, util.UUID())
+	}
 	err = Do(httpReq, times, res)
 	if err != nil {
 		return
@@ -68,11 +151,34 @@ func PostTimes(url string, times int, req, res interface{}) (err error) {
 	return
 }
 
-// Do 发送请求
-func Do(req *xhttp.Request, times int, res interface{}) error {
+// Do 发送请求, 请求的 context 中有请求ID时通过 RequestIDHeader 转发
+// 创建 client 类型的 Span, 通过 traceparent 请求头传递追踪上下文
+func Do(req *xhttp.Request, times int, res interface{}) (err error) {
+	setRequestID(req)
+	logger := log.Ctx(req.Context())
+
+	_, span := trace.Start(req.Context(), "HTTP "+req.Method, trace.KindClient)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	trace.Inject(req.Header, span.Context())
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	for i := 0; i < times; i++ {
+		span.SetAttribute("http.attempts", i+1)
+		if i > 0 {
+			clientRetries.Inc(req.URL.Host)
+			// 重试时重新读取 body, 否则发送的是已读完的 body
+			if req.GetBody != nil {
+				if req.Body, err = req.GetBody(); err != nil {
+					return err
+				}
+			}
+		}
 		// http请求
-		response, err := defaultClient.Do(req)
+		response, err := do(req)
 		if err != nil {
 			if i < times-1 {
 				time.Sleep(500 * time.Millisecond)
@@ -88,8 +194,9 @@ func Do(req *xhttp.Request, times int, res interface{}) error {
 			return err
 		}
 
+		span.SetAttribute("http.status_code", response.StatusCode)
 		if code := response.StatusCode; 299 < code || code < 200 {
-			log.Info(fmt.Sprintf("code: %d", code))
+			logger.Info(fmt.Sprintf("code: %d", code))
 			return errors.New(string(data))
 		}
 
@@ -97,7 +204,7 @@ func Do(req *xhttp.Request, times int, res interface{}) error {
 			return nil
 		}
 
-		log.Info("返回结果", "URL", req.URL.Path, "body", string(data))
+		logger.Info("返回结果", log.String("URL", req.URL.Path), log.String("body", string(data)))
 
 		err = json.Unmarshal(data, res)
 		if err != nil {
@@ -108,6 +215,42 @@ func Do(req *xhttp.Request, times int, res interface{}) error {
 	return nil
 }
 
+// Send 发送一次请求, 不重试, 返回HTTP状态码和返回数据
+func Send(req *xhttp.Request) (code int, data []byte, err error) {
+	setRequestID(req)
+	response, err := do(req)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	data, err = ioutil.ReadAll(response.Body)
+	return response.StatusCode, data, err
+}
+
+// do 发送一次请求并记录请求次数和耗时
+func do(req *xhttp.Request) (*xhttp.Response, error) {
+	start := time.Now()
+	response, err := defaultClient.Do(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(response.StatusCode)
+	}
+	clientRequests.Inc(req.Method, req.URL.Host, code)
+	clientDuration.ObserveSince(start, req.Method, req.URL.Host)
+	return response, err
+}
+
+// setRequestID 请求没有设置请求ID时, 使用 context 中的请求ID
+func setRequestID(req *xhttp.Request) {
+	if req.Header.Get(RequestIDHeader) != "" {
+		return
+	}
+	if id := log.RequestID(req.Context()); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+}
+
 // UploadFiles 上传文件
 func UploadFiles(srcFile, filename, url string) (err error) {
 	f, err := os.Open(srcFile)
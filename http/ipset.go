@@ -0,0 +1,214 @@
+package http
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// span 闭区间 [lo, hi]
+type span struct {
+	lo, hi uint32
+}
+
+// parseOctet 解析IP4表达式中的一段, 返回可选值的区间
+// 支持 '10'、'10-13'、'[10-13]'(只包含端点) 以及使用 '|' 分隔的多个可选值 '10|13'
+func parseOctet(val string) (spans []span, err error) {
+	for _, alt := range strings.Split(val, "|") {
+		endpoint := false
+		if strings.HasPrefix(alt, "[") && strings.HasSuffix(alt, "]") {
+			alt = alt[1 : len(alt)-1]
+			endpoint = true
+		}
+
+		i := strings.Index(alt, "-")
+		if i < 0 {
+			n, err := parseByte(alt)
+			if err != nil {
+				return nil, err
+			}
+			spans = append(spans, span{n, n})
+			continue
+		}
+
+		min, err := parseByte(alt[:i])
+		if err != nil {
+			return nil, err
+		}
+		max, err := parseByte(alt[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		if min > max {
+			min, max = max, min
+		}
+		if endpoint {
+			spans = append(spans, span{min, min}, span{max, max})
+		} else {
+			spans = append(spans, span{min, max})
+		}
+	}
+	return
+}
+
+func parseByte(s string) (uint32, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 255 {
+		return 0, ErrInvaildIPAddr
+	}
+	return uint32(n), nil
+}
+
+// ipMatcher 匹配单个IP表达式
+type ipMatcher interface {
+	match(ip net.IP) bool
+}
+
+// octetMatcher IP4 地址段表达式, 逐段匹配
+type octetMatcher [4][]span
+
+func (m *octetMatcher) match(ip net.IP) bool {
+	ip = ip.To4()
+	if ip == nil {
+		return false
+	}
+	for i, spans := range m {
+		ok := false
+		for _, s := range spans {
+			if uint32(ip[i]) >= s.lo && uint32(ip[i]) <= s.hi {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// netMatcher CIDR 表达式
+type netMatcher struct {
+	*net.IPNet
+}
+
+func (m netMatcher) match(ip net.IP) bool {
+	return m.Contains(ip)
+}
+
+// rangeMatcher 完整地址的区间, 如 '2001:db8::1-2001:db8::ff'
+type rangeMatcher struct {
+	lo, hi net.IP
+}
+
+func (m rangeMatcher) match(ip net.IP) bool {
+	if len(m.lo) == net.IPv4len {
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+	if ip == nil || len(ip) != len(m.lo) {
+		return false
+	}
+	return bytes.Compare(ip, m.lo) >= 0 && bytes.Compare(ip, m.hi) <= 0
+}
+
+// IPSet IP表达式集合, 匹配时不展开地址段, 适用于访问控制
+//
+// 支持 ParseIP 的表达式, 以及:
+//  IP6 地址 '2001:db8::1'
+//  完整地址的区间 '2001:db8::1-2001:db8::ff'
+// 与 ParseIP 不同, CIDR 表达式包含网络号和广播地址, '192.168.0.8/29' 匹配 192.168.0.8 到 192.168.0.15,
+// '10.0.0.1/32' 只匹配 10.0.0.1
+type IPSet struct {
+	matchers []ipMatcher
+}
+
+// NewIPSet 解析IP表达式, 每个表达式可以使用 ',' 分隔多个表达式
+func NewIPSet(exprs ...string) (*IPSet, error) {
+	s := new(IPSet)
+	for _, expr := range exprs {
+		for _, val := range strings.Split(expr, ",") {
+			val = strings.TrimSpace(val)
+			if val == "" {
+				continue
+			}
+			m, err := parseMatcher(val)
+			if err != nil {
+				return nil, err
+			}
+			s.matchers = append(s.matchers, m)
+		}
+	}
+	return s, nil
+}
+
+func parseMatcher(val string) (ipMatcher, error) {
+	if strings.Contains(val, "/") {
+		_, ipnet, err := net.ParseCIDR(val)
+		if err != nil {
+			return nil, ErrInvaildIPAddr
+		}
+		return netMatcher{ipnet}, nil
+	}
+
+	if ip := net.ParseIP(val); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		return rangeMatcher{ip, ip}, nil
+	}
+
+	if i := strings.Index(val, "-"); i > 0 {
+		lo, hi := net.ParseIP(val[:i]), net.ParseIP(val[i+1:])
+		if lo != nil && hi != nil {
+			if lo4, hi4 := lo.To4(), hi.To4(); lo4 != nil && hi4 != nil {
+				lo, hi = lo4, hi4
+			} else if lo.To4() != nil || hi.To4() != nil {
+				return nil, ErrInvaildIPAddr
+			}
+			if bytes.Compare(lo, hi) > 0 {
+				lo, hi = hi, lo
+			}
+			return rangeMatcher{lo, hi}, nil
+		}
+	}
+
+	strs := strings.Split(val, ".")
+	if len(strs) != 4 {
+		return nil, ErrInvaildIPAddr
+	}
+	m := new(octetMatcher)
+	for i, str := range strs {
+		spans, err := parseOctet(str)
+		if err != nil {
+			return nil, err
+		}
+		m[i] = spans
+	}
+	return m, nil
+}
+
+// Contains 是否匹配任一表达式
+func (s *IPSet) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, m := range s.matchers {
+		if m.match(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsString 解析 ip 并匹配, 无效的地址返回 false
+func (s *IPSet) ContainsString(ip string) bool {
+	return s.Contains(net.ParseIP(ip))
+}
+
+// Len 返回表达式数量
+func (s *IPSet) Len() int {
+	return len(s.matchers)
+}
@@ -0,0 +1,49 @@
+package http
+
+import "testing"
+
+func TestIPSet(t *testing.T) {
+	var data = []struct {
+		name  string
+		exprs []string
+		in    []string
+		out   []string
+	}{
+		{"'-'功能:连续的IP地址", []string{"192.168.0.10-13"}, []string{"192.168.0.10", "192.168.0.12", "192.168.0.13"}, []string{"192.168.0.9", "192.168.0.14"}},
+		{"'[]'功能:端点功能", []string{"192.168.[10-13].0"}, []string{"192.168.10.0", "192.168.13.0"}, []string{"192.168.11.0", "192.168.10.1"}},
+		{"'|'功能:多个可选值", []string{"10.0.1|3.1"}, []string{"10.0.1.1", "10.0.3.1"}, []string{"10.0.2.1"}},
+		{"'/'功能:CIDR表示法", []string{"192.168.10.8/29", "10.0.0.1/32"}, []string{"192.168.10.8", "192.168.10.15", "10.0.0.1"}, []string{"192.168.10.16", "10.0.0.2"}},
+		{"','功能:多个表达式", []string{"10.0.0.1,10.0.0.5-6"}, []string{"10.0.0.1", "10.0.0.6"}, []string{"10.0.0.2"}},
+		{"重复的表达式", []string{"192.168.10|13.0,192.168.10.0"}, []string{"192.168.10.0", "192.168.13.0"}, []string{"192.168.11.0"}},
+		{"IP6地址", []string{"2001:db8::1", "fd00::/8"}, []string{"2001:db8::1", "fd12::34"}, []string{"2001:db8::2", "fe80::1", "10.0.0.1"}},
+		{"完整地址的区间", []string{"2001:db8::10-2001:db8::1f", "10.0.0.250-10.0.1.5"}, []string{"2001:db8::10", "2001:db8::1a", "10.0.0.255", "10.0.1.0"}, []string{"2001:db8::20", "10.0.1.6"}},
+		{"IP4映射的IP6地址", []string{"10.0.0.0/8"}, []string{"::ffff:10.1.2.3"}, []string{"::1"}},
+	}
+
+	for _, val := range data {
+		t.Run(val.name, func(t *testing.T) {
+			s, err := NewIPSet(val.exprs...)
+			if err != nil {
+				t.Fatalf("解析IP表达式失败: %v", err)
+			}
+			for _, ip := range val.in {
+				if !s.ContainsString(ip) {
+					t.Errorf("预期 %s 匹配 %v", ip, val.exprs)
+				}
+			}
+			for _, ip := range val.out {
+				if s.ContainsString(ip) {
+					t.Errorf("预期 %s 不匹配 %v", ip, val.exprs)
+				}
+			}
+		})
+	}
+}
+
+func TestIPSetInvalid(t *testing.T) {
+	for _, expr := range []string{"192.168.0", "192.168.0.256", "10.0.0.a", "10.0.0.0/33", "10.0.0.1-::1"} {
+		if _, err := NewIPSet(expr); err != ErrInvaildIPAddr {
+			t.Errorf("预期 %s 解析失败, get: %v", expr, err)
+		}
+	}
+}
@@ -9,12 +9,21 @@ import (
 // ErrInvaildIPAddr 无效的IP地址
 var ErrInvaildIPAddr = errors.New("无效的IP地址")
 
-// ParseIP 解析IP表达式
+// ParseIP 解析IP表达式, 多个表达式使用 ',' 分隔, 结果去重
+// CIDR 表示法不包含网络号和广播地址, 而 IPSet 的 CIDR 匹配包含网络号和广播地址;
+// 只需要判断IP是否匹配表达式时使用 IPSet, 不展开地址段
 func ParseIP(reg string) (ips []string) {
+	seen := make(map[string]struct{})
 	// 解析IP4地址
 	for _, val := range strings.Split(reg, ",") {
-		if strings.Contains(reg, ".") {
-			ips = append(ips, parseIP4(val)...)
+		if !strings.Contains(val, ".") {
+			continue
+		}
+		for _, ip := range parseIP4(val) {
+			if _, ok := seen[ip]; !ok {
+				seen[ip] = struct{}{}
+				ips = append(ips, ip)
+			}
 		}
 	}
 
@@ -26,6 +35,7 @@ func ParseIP(reg string) (ips []string) {
 // 1.支持CIDR表示法,解析'192.168.0.10/29'得到: 192.168.0.9、192.168.0.10、192.168.0.11、192.168.0.12、192.168.0.13、192.168.0.14
 // 2.解析'192.168.0.10-13'得到: 192.168.0.10、 192.168.0.11、192.168.0.12、192.168.0.13
 // 3.解析'192.168.0.[10-13]'得到: 192.168.0.10、192.168.0.13
+// 4.解析'192.168.0.10|13'得到: 192.168.0.10、192.168.0.13
 func parseIP4(str string) (ips []string) {
 	var _bytes [][]byte
 	if i := strings.Index(str, "/"); i > 0 { // CIDR 表示法
@@ -81,36 +91,15 @@ func searchIP4(reg string) (ips [][]byte) {
 
 	res := make([]uint32, 1)
 	for _, val := range strs {
-		leng := len(val)
-		isEndPoint := false
-		if val[0] == '[' {
-			val = val[1:]
-			leng--
-			isEndPoint = true
-		}
-		if val[leng-1] == ']' {
-			val = val[:leng-1]
-			isEndPoint = true
+		spans, err := parseOctet(val)
+		if err != nil {
+			return nil
 		}
-
 		buff := make([]uint32, 0)
-		if i := strings.Index(val, "-"); i > 0 {
-			min, max := strNumToByte(val[:i]), strNumToByte(val[i+1:])
-			if min > max {
-				min, max = max, min
-			}
-			b := make([]uint32, 0)
-			switch {
-			case isEndPoint:
-				b = append(b, uint32(min), uint32(max))
-			default:
-				for i := min; i <= max; i++ {
-					b = append(b, uint32(i))
-				}
+		for _, sp := range spans {
+			for i := sp.lo; i <= sp.hi; i++ {
+				buff = append(buff, i)
 			}
-			buff = append(buff, b...)
-		} else {
-			buff = append(buff, uint32(strNumToByte(val)))
 		}
 
 		_res := make([]uint32, 0, len(res)*len(buff))
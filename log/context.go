@@ -0,0 +1,39 @@
+package log
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// RequestIDKey 日志中请求ID的字段名
+const RequestIDKey = "request_id"
+
+type requestIDKey struct{}
+
+// WithRequestID 返回保存请求ID的 context, Ctx 返回的日志会带上该请求ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID 返回 context 中保存的请求ID, 没有时返回空字符串
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// With 返回带有固定字段的日志
+func With(fields ...zap.Field) Logger {
+	return zlog.With(fields...)
+}
+
+// Ctx 返回带有 context 中请求ID的日志, 没有请求ID时返回全局日志
+func Ctx(ctx context.Context) Logger {
+	if id := RequestID(ctx); id != "" {
+		return zlog.With(zap.String(RequestIDKey, id))
+	}
+	return zlog
+}
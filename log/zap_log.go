@@ -9,7 +9,15 @@ import (
 	"time"
 )
 
-var zlog *zap.Logger
+// zlog 全局日志, 未调用 InitLogger 前不输出任何内容
+var zlog = zap.NewNop()
+
+// Logger 日志接口, *zap.Logger 已实现该接口
+type Logger interface {
+	Info(msg string, fields ...zap.Field)
+	Debug(msg string, fields ...zap.Field)
+	Error(msg string, fields ...zap.Field)
+}
 
 type Options struct {
 	FileName    string // log file name  带路径
@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefBuckets 默认的直方图桶, 适用于以秒为单位的耗时
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// atomicFloat 并发安全的浮点数
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&f.bits, old, n) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// series 按标签值保存的时间序列
+type series struct {
+	d      desc
+	m      sync.RWMutex
+	values map[string]interface{}
+	labels map[string][]string
+}
+
+func newSeries(name, help, typ string, labels []string) series {
+	return series{
+		d:      desc{name: name, help: help, typ: typ, labels: labels},
+		values: make(map[string]interface{}),
+		labels: make(map[string][]string),
+	}
+}
+
+func (s *series) desc() *desc {
+	return &s.d
+}
+
+// get 返回标签值对应的序列, 不存在时使用 create 创建
+func (s *series) get(values []string, create func() interface{}) interface{} {
+	key := s.d.labelKey(values)
+	s.m.RLock()
+	v, ok := s.values[key]
+	s.m.RUnlock()
+	if ok {
+		return v
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if v, ok = s.values[key]; ok {
+		return v
+	}
+	v = create()
+	s.values[key] = v
+	s.labels[key] = append([]string(nil), values...)
+	return v
+}
+
+// find 返回标签值对应的序列, 不创建
+func (s *series) find(values []string) (interface{}, bool) {
+	key := s.d.labelKey(values)
+	s.m.RLock()
+	defer s.m.RUnlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// Delete 删除标签值对应的序列, 如已关闭的协程池
+func (s *series) Delete(values ...string) {
+	key := s.d.labelKey(values)
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.values, key)
+	delete(s.labels, key)
+}
+
+// each 按标签值排序遍历序列
+func (s *series) each(fn func(labels []string, v interface{})) {
+	s.m.RLock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]interface{}, len(keys))
+	labels := make([][]string, len(keys))
+	for i, key := range keys {
+		values[i], labels[i] = s.values[key], s.labels[key]
+	}
+	s.m.RUnlock()
+
+	for i := range keys {
+		fn(labels[i], values[i])
+	}
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	series
+}
+
+func newCounter(name, help string, labels []string) *Counter {
+	return &Counter{newSeries(name, help, "counter", labels)}
+}
+
+// Inc 计数加 1
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add 计数增加 v, v 小于 0 时 panic
+func (c *Counter) Add(v float64, labels ...string) {
+	if v < 0 {
+		panic("metrics: 计数器不能减少")
+	}
+	c.value(labels).add(v)
+}
+
+// Value 返回当前计数
+func (c *Counter) Value(labels ...string) float64 {
+	if v, ok := c.find(labels); ok {
+		return v.(*atomicFloat).load()
+	}
+	return 0
+}
+
+func (c *Counter) value(labels []string) *atomicFloat {
+	return c.get(labels, func() interface{} { return new(atomicFloat) }).(*atomicFloat)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.each(func(labels []string, v interface{}) {
+		w.WriteString(c.d.name + c.d.labelString(labels) + " " + formatFloat(v.(*atomicFloat).load()) + "\n")
+	})
+}
+
+// Gauge 可增可减的仪表盘
+type Gauge struct {
+	series
+}
+
+func newGauge(name, help string, labels []string) *Gauge {
+	return &Gauge{newSeries(name, help, "gauge", labels)}
+}
+
+// Set 设置为 v
+func (g *Gauge) Set(v float64, labels ...string) {
+	g.value(labels).set(v)
+}
+
+// Add 增加 v, v 可以为负数
+func (g *Gauge) Add(v float64, labels ...string) {
+	g.value(labels).add(v)
+}
+
+// Inc 加 1
+func (g *Gauge) Inc(labels ...string) {
+	g.Add(1, labels...)
+}
+
+// Dec 减 1
+func (g *Gauge) Dec(labels ...string) {
+	g.Add(-1, labels...)
+}
+
+// Value 返回当前值
+func (g *Gauge) Value(labels ...string) float64 {
+	if v, ok := g.find(labels); ok {
+		return v.(*atomicFloat).load()
+	}
+	return 0
+}
+
+func (g *Gauge) value(labels []string) *atomicFloat {
+	return g.get(labels, func() interface{} { return new(atomicFloat) }).(*atomicFloat)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.each(func(labels []string, v interface{}) {
+		w.WriteString(g.d.name + g.d.labelString(labels) + " " + formatFloat(v.(*atomicFloat).load()) + "\n")
+	})
+}
+
+// Histogram 直方图, 统计观测值的分布
+type Histogram struct {
+	series
+	buckets []float64
+}
+
+type histogramValue struct {
+	counts []uint64 // 每个桶的计数, 不累加
+	count  uint64
+	sum    atomicFloat
+}
+
+func newHistogram(name, help string, buckets []float64, labels []string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{series: newSeries(name, help, "histogram", labels), buckets: buckets}
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64, labels ...string) {
+	hv := h.value(labels)
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		atomic.AddUint64(&hv.counts[i], 1)
+	}
+	atomic.AddUint64(&hv.count, 1)
+	hv.sum.add(v)
+}
+
+func (h *Histogram) value(labels []string) *histogramValue {
+	return h.get(labels, func() interface{} {
+		return &histogramValue{counts: make([]uint64, len(h.buckets))}
+	}).(*histogramValue)
+}
+
+// ObserveSince 记录从 start 开始经过的秒数
+func (h *Histogram) ObserveSince(start time.Time, labels ...string) {
+	h.Observe(time.Since(start).Seconds(), labels...)
+}
+
+// Count 返回观测值数量
+func (h *Histogram) Count(labels ...string) uint64 {
+	if v, ok := h.find(labels); ok {
+		return atomic.LoadUint64(&v.(*histogramValue).count)
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.each(func(labels []string, v interface{}) {
+		hv := v.(*histogramValue)
+		var cum uint64
+		for i, upper := range h.buckets {
+			cum += atomic.LoadUint64(&hv.counts[i])
+			w.WriteString(h.d.name + "_bucket" + h.d.labelString(labels, "le", formatFloat(upper)) + " " + formatFloat(float64(cum)) + "\n")
+		}
+		// 并发观测时桶的计数可能先于总数增加, 保证 +Inf 桶不小于其他桶
+		count := atomic.LoadUint64(&hv.count)
+		if count < cum {
+			count = cum
+		}
+		w.WriteString(h.d.name + "_bucket" + h.d.labelString(labels, "le", "+Inf") + " " + formatFloat(float64(count)) + "\n")
+		w.WriteString(h.d.name + "_sum" + h.d.labelString(labels) + " " + formatFloat(hv.sum.load()) + "\n")
+		w.WriteString(h.d.name + "_count" + h.d.labelString(labels) + " " + formatFloat(float64(count)) + "\n")
+	})
+}
@@ -0,0 +1,205 @@
+// Package metrics 实现计数器、仪表盘和直方图, 以 Prometheus 文本格式输出, 不依赖第三方库
+//
+//	var orders = metrics.NewCounter("shop_orders_total", "订单数量", "status")
+//	orders.Inc("paid")
+//
+// 路由、协程池、http 客户端和回调已内置以 hit_ 开头的指标, 通过 Handler 输出
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType Prometheus 文本格式的内容类型
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Default 默认的指标注册表, 包内的 NewCounter、NewGauge、NewHistogram 注册到该注册表
+var Default = NewRegistry()
+
+// Collector 可以输出的指标
+type Collector interface {
+	desc() *desc
+	write(w *bufio.Writer)
+}
+
+// Registry 指标注册表
+type Registry struct {
+	m          sync.RWMutex
+	collectors map[string]Collector
+}
+
+// NewRegistry 返回空的注册表
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// register 注册指标, 同名指标已存在时返回已注册的指标
+// 同名指标的类型或标签不一致时 panic
+func (r *Registry) register(c Collector) Collector {
+	d := c.desc()
+	r.m.Lock()
+	defer r.m.Unlock()
+	if old, ok := r.collectors[d.name]; ok {
+		od := old.desc()
+		if od.typ != d.typ || strings.Join(od.labels, ",") != strings.Join(d.labels, ",") {
+			panic("metrics: " + d.name + " 已注册为不同类型或标签的指标")
+		}
+		return old
+	}
+	r.collectors[d.name] = c
+	return c
+}
+
+// NewCounter 在注册表中创建计数器, 同名计数器已存在时返回已存在的计数器
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return r.register(newCounter(name, help, labels)).(*Counter)
+}
+
+// NewGauge 在注册表中创建仪表盘, 同名仪表盘已存在时返回已存在的仪表盘
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return r.register(newGauge(name, help, labels)).(*Gauge)
+}
+
+// NewHistogram 在注册表中创建直方图, 同名直方图已存在时返回已存在的直方图
+// buckets: 桶的上界, 为空时使用 DefBuckets
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return r.register(newHistogram(name, help, buckets, labels)).(*Histogram)
+}
+
+// WriteTo 以 Prometheus 文本格式输出全部指标, 按名称排序
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.m.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]Collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.m.RUnlock()
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		d := c.desc()
+		bw.WriteString("# HELP " + d.name + " " + escapeHelp(d.help) + "\n")
+		bw.WriteString("# TYPE " + d.name + " " + d.typ + "\n")
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler 输出注册表中全部指标的 http.Handler
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(w)
+	})
+}
+
+// NewCounter 在默认注册表中创建计数器
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewGauge 在默认注册表中创建仪表盘
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewHistogram 在默认注册表中创建直方图
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// Handler 输出默认注册表中全部指标的 http.Handler
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// desc 指标的描述
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+// labelString 返回 {k="v",...} 格式的标签, extra 为额外的标签, 如直方图的 le
+func (d *desc) labelString(values []string, extra ...string) string {
+	if len(d.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range d.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l + `="` + escapeLabel(values[i]) + `"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra[i] + `="` + escapeLabel(extra[i+1]) + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelKey 标签值组合成的 key, 标签数量不一致时 panic
+func (d *desc) labelKey(values []string) string {
+	if len(values) != len(d.labels) {
+		panic("metrics: " + d.name + " 需要 " + strconv.Itoa(len(d.labels)) + " 个标签值")
+	}
+	return strings.Join(values, "\xff")
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// formatFloat 按 Prometheus 文本格式输出数值
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countWriter 统计写入的字节数
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	return n, err
+}
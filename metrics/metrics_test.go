@@ -0,0 +1,89 @@
+package metrics_test
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HiData-xyz/hit/metrics"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("测试 Prometheus 文本格式输出", t, func() {
+		r := metrics.NewRegistry()
+		orders := r.NewCounter("shop_orders_total", "订单数量", "status")
+		orders.Inc("paid")
+		orders.Add(2, "paid")
+		orders.Inc(`a"b\c`)
+		So(orders.Value("paid"), ShouldEqual, 3)
+		So(orders.Value("none"), ShouldEqual, 0)
+		So(func() { orders.Add(-1, "paid") }, ShouldPanic)
+		So(func() { orders.Inc() }, ShouldPanic)
+
+		temp := r.NewGauge("room_temperature", "温度\n摄氏度")
+		temp.Set(20)
+		temp.Dec()
+		temp.Add(0.5)
+		So(temp.Value(), ShouldEqual, 19.5)
+
+		latency := r.NewHistogram("api_latency_seconds", "接口耗时", []float64{0.5, 0.1, 1}, "api")
+		for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+			latency.Observe(v, "list")
+		}
+		So(latency.Count("list"), ShouldEqual, 4)
+
+		var buf bytes.Buffer
+		n, err := r.WriteTo(&buf)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, buf.Len())
+		So(buf.String(), ShouldEqual, `# HELP api_latency_seconds 接口耗时
+# TYPE api_latency_seconds histogram
+api_latency_seconds_bucket{api="list",le="0.1"} 2
+api_latency_seconds_bucket{api="list",le="0.5"} 3
+api_latency_seconds_bucket{api="list",le="1"} 3
+api_latency_seconds_bucket{api="list",le="+Inf"} 4
+api_latency_seconds_sum{api="list"} 2.45
+api_latency_seconds_count{api="list"} 4
+# HELP room_temperature 温度\n摄氏度
+# TYPE room_temperature gauge
+room_temperature 19.5
+# HELP shop_orders_total 订单数量
+# TYPE shop_orders_total counter
+shop_orders_total{status="a\"b\\c"} 1
+shop_orders_total{status="paid"} 3
+`)
+
+		Convey("同名指标返回已注册的指标, 类型或标签不一致时 panic", func() {
+			So(r.NewCounter("shop_orders_total", "订单数量", "status"), ShouldEqual, orders)
+			So(func() { r.NewGauge("shop_orders_total", "订单数量", "status") }, ShouldPanic)
+			So(func() { r.NewCounter("shop_orders_total", "订单数量", "shop") }, ShouldPanic)
+		})
+
+		Convey("删除序列", func() {
+			orders.Delete("paid")
+			buf.Reset()
+			r.WriteTo(&buf)
+			So(buf.String(), ShouldNotContainSubstring, `status="paid"`)
+		})
+
+		Convey("特殊数值", func() {
+			temp.Set(math.Inf(1))
+			buf.Reset()
+			r.WriteTo(&buf)
+			So(buf.String(), ShouldContainSubstring, "room_temperature +Inf\n")
+		})
+
+		Convey("通过 Handler 输出", func() {
+			w := httptest.NewRecorder()
+			r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("Content-Type"), ShouldEqual, metrics.ContentType)
+			So(strings.HasPrefix(w.Body.String(), "# HELP api_latency_seconds"), ShouldBeTrue)
+		})
+	})
+}
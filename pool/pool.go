@@ -3,8 +3,13 @@ package pool
 import (
 	"context"
 	"errors"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/HiData-xyz/hit/metrics"
+	"github.com/HiData-xyz/hit/trace"
 )
 
 var (
@@ -13,7 +18,16 @@ var (
 	// ErrClosed 协程池已关闭
 	ErrClosed = errors.New("协程池已关闭")
 )
-var defaultPool = NewPool(100, 10000)
+
+// 协程池内置的指标, 按协程池名称区分
+var (
+	queueDepth = metrics.NewGauge("hit_pool_queue_depth", "协程池队列中等待执行的任务数", "pool")
+	workers    = metrics.NewGauge("hit_pool_workers", "协程池已开启的协程数", "pool")
+)
+
+var poolSeq int32 // 未命名协程池的序号
+
+var defaultPool = NewPool(100, 10000).SetName("default")
 
 // Handle 接收的任务对象
 type Handle func()
@@ -38,6 +52,8 @@ type Pool struct {
 
 	ctx    context.Context // 同步信号
 	cancel context.CancelFunc
+
+	name atomic.Value // 指标中的协程池名称
 }
 
 // NewPool 获取一个协程池对象
@@ -48,13 +64,40 @@ func NewPool(limitChan, limitQueue int32) *Pool {
 	p.queue = make(chan *task, limitQueue)
 	p.timeout = 10 * time.Second
 	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.name.Store("pool-" + strconv.Itoa(int(atomic.AddInt32(&poolSeq, 1))))
 	go p.Run()
 	return p
 }
 
+// SetName 设置指标中的协程池名称, 默认为 pool-序号
+func (p *Pool) SetName(name string) *Pool {
+	old := p.Name()
+	p.name.Store(name)
+	queueDepth.Delete(old)
+	workers.Delete(old)
+	p.observe()
+	return p
+}
+
+// Name 返回指标中的协程池名称
+func (p *Pool) Name() string {
+	return p.name.Load().(string)
+}
+
+// observe 更新队列长度和协程数指标
+func (p *Pool) observe() {
+	name := p.Name()
+	queueDepth.Set(float64(len(p.queue)), name)
+	p.m.Lock()
+	used := p.used
+	p.m.Unlock()
+	workers.Set(float64(used), name)
+}
+
 // Run 启动协程池
 func (p *Pool) Run() {
 	for _task := range p.queue {
+		queueDepth.Set(float64(len(p.queue)), p.Name())
 		// 尝试使用空闲的协程
 		select {
 		case ch, ok := <-p.free:
@@ -73,6 +116,7 @@ func (p *Pool) Run() {
 		p.m.Lock()
 		if p.used < p.limitChan {
 			p.used++
+			workers.Set(float64(p.used), p.Name())
 			ch := make(chan *task)
 			go func(ctx context.Context, ch chan *task) {
 				ctx, cancel := context.WithCancel(ctx)
@@ -88,7 +132,7 @@ func (p *Pool) Run() {
 					case <-ctx.Done():
 						return
 					case <-time.After(p.timeout):
-						_task.p.release()
+						p.release()
 					}
 				}
 
@@ -124,6 +168,34 @@ func (p *Pool) Push(h Handle) error {
 	case <-time.After(p.timeout):
 		return ErrTooBusy
 	}
+	queueDepth.Set(float64(len(p.queue)), p.Name())
+
+	return nil
+}
+
+// PushContext 向队列添加新的任务, 任务作为 ctx 中 Span 的子 Span 执行
+// h 接收保存任务 Span 的 context, 任务中发起的请求可以继续传递追踪上下文
+func (p *Pool) PushContext(ctx context.Context, name string, h func(ctx context.Context)) error {
+	queued := time.Now()
+	return p.Push(func() {
+		c, span := trace.Start(ctx, name, trace.KindInternal)
+		span.SetAttribute("pool.wait", time.Since(queued).String())
+		defer span.End()
+		h(c)
+	})
+}
+
+// TryPush 向队列添加新的任务, 队列已满时立即返回 ErrTooBusy, 不等待
+func (p *Pool) TryPush(h Handle) error {
+	_task := newTask(p, h)
+	select {
+	case <-p.ctx.Done():
+		return ErrClosed
+	case p.queue <- _task:
+	default:
+		return ErrTooBusy
+	}
+	queueDepth.Set(float64(len(p.queue)), p.Name())
 
 	return nil
 }
@@ -132,6 +204,8 @@ func (p *Pool) Push(h Handle) error {
 // TODO: 确保队列中的任务执行完毕后关闭
 func (p *Pool) Close() {
 	p.cancel()
+	queueDepth.Delete(p.Name())
+	workers.Delete(p.Name())
 }
 
 // recycle 回收空闲的协程
@@ -153,6 +227,7 @@ func (p *Pool) release() {
 		close(ch)
 		p.m.Lock()
 		p.used--
+		workers.Set(float64(p.used), p.Name())
 		p.m.Unlock()
 	default:
 	}
@@ -177,3 +252,8 @@ func newTask(p *Pool, h Handle) *task {
 func Push(h Handle) error {
 	return defaultPool.Push(h)
 }
+
+// PushContext 向队列添加新的任务, 任务作为 ctx 中 Span 的子 Span 执行
+func PushContext(ctx context.Context, name string, h func(ctx context.Context)) error {
+	return defaultPool.PushContext(ctx, name, h)
+}
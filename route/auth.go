@@ -0,0 +1,197 @@
+package route
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strconv"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 认证方式
+const (
+	AuthJWT    = "jwt"
+	AuthBasic  = "basic"
+	AuthAPIKey = "apikey"
+)
+
+// APIKeyHeader 默认读取 API Key 的请求头
+const APIKeyHeader = "X-API-Key"
+
+// ErrCredentialNotFound 凭证不存在, CredentialStore 查找不到凭证时返回
+var ErrCredentialNotFound = errors.New("credential not found")
+
+// Principal 认证通过的调用方
+type Principal struct {
+	ID     string                 // 调用方标识, JWT 中为 sub, Basic 中为用户名
+	Method string                 // 认证方式 AuthJWT、AuthBasic、AuthAPIKey
+	Roles  []string               // 角色, Require 通过授权策略转换成权限
+	Scopes []string               // 直接授予的权限
+	Extra  map[string]interface{} // 其他信息
+}
+
+// Credential 保存的凭证, 只保存密钥的摘要
+type Credential struct {
+	Principal
+	// Hash 密钥的摘要, 密码为 HashPassword 生成的 bcrypt 摘要, API Key 为 HashSecret 生成的摘要
+	Hash string
+}
+
+// NewCredential 返回保存密码 bcrypt 摘要的凭证, 用于 Basic 认证
+func NewCredential(p Principal, password string) *Credential {
+	return &Credential{Principal: p, Hash: HashPassword(password)}
+}
+
+// HashPassword 返回密码的 bcrypt 摘要, 每次调用使用新的随机盐
+func HashPassword(password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		// 只有 cost 无效时返回错误
+		panic(err)
+	}
+	return string(hash)
+}
+
+// VerifyPassword 校验密码与 HashPassword 生成的摘要是否匹配
+func VerifyPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// HashSecret 返回密钥的 SHA-256 摘要, 用于 API Key 等高熵的随机密钥, 密码使用 HashPassword
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySecret 使用常数时间比较 secret 与摘要 hash 是否匹配
+func VerifySecret(hash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hash)) == 1
+}
+
+// CredentialStore 凭证存储
+// Basic 认证使用用户名查找, API Key 认证使用 HashSecret(key) 查找
+// 凭证不存在时返回 ErrCredentialNotFound
+type CredentialStore interface {
+	Lookup(id string) (*Credential, error)
+}
+
+// CredentialFunc 函数形式的凭证存储
+type CredentialFunc func(id string) (*Credential, error)
+
+// Lookup 实现 CredentialStore
+func (f CredentialFunc) Lookup(id string) (*Credential, error) {
+	return f(id)
+}
+
+// Credentials 内存中的凭证存储, 初始化后只读
+type Credentials map[string]*Credential
+
+// Lookup 实现 CredentialStore
+func (cs Credentials) Lookup(id string) (*Credential, error) {
+	c, ok := cs[id]
+	if !ok {
+		return nil, ErrCredentialNotFound
+	}
+	return c, nil
+}
+
+// APIKeys 返回以 API Key 摘要为索引的内存凭证存储
+// keys: API Key 到调用方的映射
+func APIKeys(keys map[string]Principal) Credentials {
+	cs := make(Credentials, len(keys))
+	for key, p := range keys {
+		c := &Credential{Principal: p, Hash: HashSecret(key)}
+		cs[c.Hash] = c
+	}
+	return cs
+}
+
+// BasicAuth HTTP Basic 认证中间件, 认证通过后可以通过 ctx.Principal 获取调用方
+// realm: 认证失败时 WWW-Authenticate 返回的 realm
+// store: 以用户名为索引的凭证存储, 凭证使用 NewCredential 或 HashPassword 生成
+func BasicAuth(realm string, store CredentialStore) Handler {
+	challenge := "Basic realm=" + strconv.Quote(realm)
+	// dummy 用户不存在时参与比较, 使响应时间与用户是否存在无关
+	dummy := HashPassword("")
+
+	return func(ctx *Context) {
+		user, pass, ok := ctx.r.BasicAuth()
+		if !ok {
+			ctx.w.Header().Set("WWW-Authenticate", challenge)
+			ctx.Error(ErrUnauthorized)
+			return
+		}
+
+		c, err := store.Lookup(user)
+		if err != nil && err != ErrCredentialNotFound {
+			ctx.Error(ErrInternal.WithErr(err))
+			return
+		}
+		hash := dummy
+		if c != nil {
+			hash = c.Hash
+		}
+		if !VerifyPassword(hash, pass) || c == nil {
+			ctx.w.Header().Set("WWW-Authenticate", challenge)
+			ctx.Error(ErrUnauthorized)
+			return
+		}
+
+		p := c.Principal
+		if p.ID == "" {
+			p.ID = user
+		}
+		p.Method = AuthBasic
+		ctx.SetPrincipal(&p)
+	}
+}
+
+// APIKey API Key 认证中间件, 认证通过后可以通过 ctx.Principal 获取调用方
+// store: 以 HashSecret(key) 为索引的凭证存储, 可以使用 APIKeys 创建
+// extractors: 提取 API Key 的方式, 默认读取 APIKeyHeader 请求头
+func APIKey(store CredentialStore, extractors ...TokenExtractor) Handler {
+	if len(extractors) == 0 {
+		extractors = []TokenExtractor{FromHeader(APIKeyHeader)}
+	}
+
+	return func(ctx *Context) {
+		var key string
+		for _, ex := range extractors {
+			if key = ex(ctx.r); key != "" {
+				break
+			}
+		}
+		if key == "" {
+			ctx.Error(ErrUnauthorized)
+			return
+		}
+
+		hash := HashSecret(key)
+		c, err := store.Lookup(hash)
+		if err != nil && err != ErrCredentialNotFound {
+			ctx.Error(ErrInternal.WithErr(err))
+			return
+		}
+		if c == nil || subtle.ConstantTimeCompare([]byte(hash), []byte(c.Hash)) != 1 {
+			ctx.Error(ErrUnauthorized)
+			return
+		}
+
+		p := c.Principal
+		p.Method = AuthAPIKey
+		ctx.SetPrincipal(&p)
+	}
+}
+
+// SetPrincipal 设置认证通过的调用方, 自定义认证中间件使用
+func (ctx *Context) SetPrincipal(p *Principal) {
+	ctx.principal = p
+	ctx.subject = p.ID
+}
+
+// Principal 返回认证通过的调用方, 未认证时为 nil
+func (ctx *Context) Principal() *Principal {
+	return ctx.principal
+}
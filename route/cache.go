@@ -0,0 +1,408 @@
+package route
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HiData-xyz/hit/metrics"
+)
+
+// CacheHeader 响应头, 返回 HIT 或 MISS 表示是否命中缓存
+const CacheHeader = "X-Cache"
+
+// cacheRequests 缓存中间件的命中情况, result 为 hit、miss 或 bypass
+var cacheRequests = metrics.NewCounter("hit_cache_requests_total", "响应缓存的命中情况", "result")
+
+// CachedResponse 缓存的响应, 缓存后不可修改
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	ETag    string
+	Created time.Time
+	Expires time.Time
+	// Vary 响应的 Vary 请求头, 不为空时按这些请求头的值分别缓存,
+	// key 下只保存 Vary, 响应保存在附加了请求头的值的 key 下
+	Vary []string
+}
+
+// size 估算占用的字节数
+func (res *CachedResponse) size() int64 {
+	n := int64(len(res.Body))
+	for k, vs := range res.Header {
+		n += int64(len(k))
+		for _, v := range vs {
+			n += int64(len(v))
+		}
+	}
+	return n
+}
+
+// CacheStore 响应缓存的存储
+type CacheStore interface {
+	// Get 返回未过期的响应
+	Get(key string) (*CachedResponse, bool)
+	// Set 保存响应, 到达 res.Expires 后过期
+	Set(key string, res *CachedResponse)
+	// DeletePrefix 删除以 prefix 开头的 key, 返回删除的数量
+	DeletePrefix(prefix string) int
+}
+
+// LRUCache 限制条目数和总字节数的 LRU 缓存, 超出时淘汰最久未使用的响应
+type LRUCache struct {
+	m          sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	size       int64
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type lruEntry struct {
+	key  string
+	res  *CachedResponse
+	size int64
+}
+
+// NewLRUCache 返回 LRU 缓存
+// maxEntries: 最大条目数, 默认 1024; maxBytes: 最大字节数, 默认 64MB
+func NewLRUCache(maxEntries int, maxBytes int64) *LRUCache {
+	if maxEntries <= 0 {
+		maxEntries = 1024
+	}
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	return &LRUCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get 实现 CacheStore, 过期的响应在读取时删除
+func (c *LRUCache) Get(key string) (*CachedResponse, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.res.Expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.res, true
+}
+
+// Set 实现 CacheStore, 超过 maxBytes 的响应不缓存
+func (c *LRUCache) Set(key string, res *CachedResponse) {
+	size := res.size() + int64(len(key))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, res: res, size: size})
+	c.size += size
+	for c.ll.Len() > c.maxEntries || c.size > c.maxBytes {
+		c.remove(c.ll.Back())
+	}
+}
+
+// DeletePrefix 实现 CacheStore
+func (c *LRUCache) DeletePrefix(prefix string) int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var n int
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+			n++
+		}
+	}
+	return n
+}
+
+// Len 返回缓存的条目数
+func (c *LRUCache) Len() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LRUCache) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*lruEntry)
+	delete(c.items, e.key)
+	c.size -= e.size
+}
+
+// CacheKeyFunc 返回缓存的 key, 返回空字符串时不缓存
+type CacheKeyFunc func(ctx *Context) string
+
+// CacheKey 使用请求路径和 params 指定的查询参数作为 key, params 为空时使用全部查询参数
+// 路由不区分大小写, 路径统一转为小写, 可以按路径前缀失效
+func CacheKey(params ...string) CacheKeyFunc {
+	return func(ctx *Context) string {
+		query := ctx.r.URL.Query()
+		if len(params) > 0 {
+			selected := make(url.Values, len(params))
+			for _, p := range params {
+				if vs, ok := query[p]; ok {
+					selected[p] = vs
+				}
+			}
+			query = selected
+		}
+		key := strings.ToLower(ctx.r.URL.Path)
+		if len(query) > 0 {
+			// Encode 按参数名排序, 参数顺序不同的请求使用同一个 key
+			for _, vs := range query {
+				sort.Strings(vs)
+			}
+			key += "?" + query.Encode()
+		}
+		return key
+	}
+}
+
+// CacheKeyBySubject 在 CacheKey 的基础上区分认证通过的调用方, 需要在认证中间件之后执行
+func CacheKeyBySubject(params ...string) CacheKeyFunc {
+	key := CacheKey(params...)
+	return func(ctx *Context) string {
+		return key(ctx) + "#sub:" + ctx.Subject()
+	}
+}
+
+// CacheConfig 响应缓存配置
+type CacheConfig struct {
+	TTL     time.Duration // 缓存时间, 默认 1 分钟
+	Key     CacheKeyFunc  // 缓存的 key, 默认 CacheKey()
+	Store   CacheStore    // 缓存存储, 默认 NewLRUCache(0, 0)
+	MaxBody int64         // 超过该长度的响应不缓存, 默认 1MB
+}
+
+// Cache 响应缓存中间件, 只缓存 GET 请求的 200 响应
+//
+// 响应没有 ETag 时根据 body 生成, 请求的 If-None-Match 匹配时返回 304;
+// 请求头 Cache-Control: no-cache 时不使用缓存并刷新, no-store 时不使用也不写入缓存;
+// 响应头 Cache-Control 包含 no-store、private 或设置了 Cookie 的响应不缓存, 包括之前的中间件设置的响应头;
+// 响应有 Vary 时按 Vary 的请求头的值分别缓存, Vary: * 时不缓存
+type Cache struct {
+	cfg CacheConfig
+}
+
+// NewCache 返回响应缓存中间件
+func NewCache(cfg CacheConfig) *Cache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Minute
+	}
+	if cfg.Key == nil {
+		cfg.Key = CacheKey()
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewLRUCache(0, 0)
+	}
+	if cfg.MaxBody <= 0 {
+		cfg.MaxBody = 1 << 20
+	}
+	return &Cache{cfg: cfg}
+}
+
+// Invalidate 删除 key 以 prefix 开头的缓存, 返回删除的数量
+// 使用默认的 key 时, prefix 为小写的请求路径, 如 "/api/orders"
+func (c *Cache) Invalidate(prefix string) int {
+	return c.cfg.Store.DeletePrefix(prefix)
+}
+
+// Handle 中间件方法
+func (c *Cache) Handle(ctx *Context) {
+	if ctx.r.Method != http.MethodGet {
+		return
+	}
+	key := c.cfg.Key(ctx)
+	if key == "" {
+		return
+	}
+
+	directives := ctx.r.Header.Get("Cache-Control")
+	noStore := hasDirective(directives, "no-store")
+	noCache := noStore || hasDirective(directives, "no-cache") || ctx.r.Header.Get("Pragma") == "no-cache"
+	if !noCache {
+		res, ok := c.cfg.Store.Get(key)
+		if ok && len(res.Vary) > 0 {
+			res, ok = c.cfg.Store.Get(key + varyKey(ctx.r.Header, res.Vary))
+		}
+		if ok {
+			cacheRequests.Inc("hit")
+			c.writeCached(ctx, res)
+			return
+		}
+	}
+	if noCache {
+		cacheRequests.Inc("bypass")
+	} else {
+		cacheRequests.Inc("miss")
+	}
+
+	w := ctx.w
+	bw := newBufferWriter()
+	ctx.w = bw
+	defer func() {
+		ctx.w = w
+	}()
+	ctx.Next()
+	ctx.w = w
+
+	// 只缓存方法链中设置的响应头, 之前的中间件设置的响应头每次请求重新设置
+	if bw.status == http.StatusOK && bw.header.Get("ETag") == "" {
+		bw.header.Set("ETag", etag(bw.body.Bytes()))
+	}
+	h := w.Header()
+	for k, vs := range bw.header {
+		h[k] = vs
+	}
+	if bw.status == 0 && bw.body.Len() == 0 {
+		return
+	}
+	if bw.status == http.StatusOK {
+		// 按最终的响应头判断, 包括之前的中间件设置的 Set-Cookie、Cache-Control 和 Vary
+		vary, ok := varyHeaders(h)
+		if ok && !noStore && c.cacheable(h, bw.body.Len()) {
+			now := time.Now()
+			res := &CachedResponse{
+				Status:  bw.status,
+				Header:  bw.header.Clone(),
+				Body:    append([]byte(nil), bw.body.Bytes()...),
+				ETag:    bw.header.Get("ETag"),
+				Created: now,
+				Expires: now.Add(c.cfg.TTL),
+				Vary:    vary,
+			}
+			if len(vary) > 0 {
+				c.cfg.Store.Set(key, &CachedResponse{Created: now, Expires: res.Expires, Vary: vary})
+				key += varyKey(ctx.r.Header, vary)
+			}
+			c.cfg.Store.Set(key, res)
+		}
+		h.Set(CacheHeader, "MISS")
+		if matchETag(ctx.r.Header.Get("If-None-Match"), h.Get("ETag")) {
+			h.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.WriteHeader(bw.status)
+	w.Write(bw.body.Bytes())
+}
+
+// writeCached 返回缓存的响应, If-None-Match 匹配时返回 304
+func (c *Cache) writeCached(ctx *Context, res *CachedResponse) {
+	defer ctx.Stop()
+	ctx.written = true
+	h := ctx.w.Header()
+	for k, vs := range res.Header {
+		h[k] = append([]string(nil), vs...)
+	}
+	h.Set(CacheHeader, "HIT")
+	h.Set("Age", strconv.Itoa(int(time.Since(res.Created)/time.Second)))
+	if matchETag(ctx.r.Header.Get("If-None-Match"), res.ETag) {
+		h.Del("Content-Length")
+		ctx.w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	ctx.w.WriteHeader(res.Status)
+	ctx.w.Write(res.Body)
+}
+
+// cacheable 响应是否可以缓存
+func (c *Cache) cacheable(h http.Header, size int) bool {
+	if int64(size) > c.cfg.MaxBody || h.Get("Set-Cookie") != "" {
+		return false
+	}
+	directives := h.Get("Cache-Control")
+	return !hasDirective(directives, "no-store") && !hasDirective(directives, "private")
+}
+
+// varyHeaders 返回响应头 Vary 中的请求头, 按名称排序, 包含 * 时返回 false
+func varyHeaders(h http.Header) ([]string, bool) {
+	var names []string
+	seen := make(map[string]struct{})
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name == "" {
+				continue
+			}
+			name = http.CanonicalHeaderKey(name)
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+// varyKey 返回 Vary 的请求头的值组成的 key 后缀
+func varyKey(h http.Header, vary []string) string {
+	values := make(url.Values, len(vary))
+	for _, name := range vary {
+		values[strings.ToLower(name)] = []string{strings.Join(h.Values(name), ", ")}
+	}
+	return "#vary:" + values.Encode()
+}
+
+// hasDirective Cache-Control 是否包含指令 name
+func hasDirective(cacheControl, name string) bool {
+	for _, d := range strings.Split(cacheControl, ",") {
+		d = strings.TrimSpace(d)
+		if i := strings.Index(d, "="); i >= 0 {
+			d = d[:i]
+		}
+		if strings.EqualFold(d, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// etag 根据 body 生成强 ETag
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// matchETag If-None-Match 是否匹配 ETag, 使用弱比较
+func matchETag(ifNoneMatch, tag string) bool {
+	if ifNoneMatch == "" || tag == "" {
+		return false
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
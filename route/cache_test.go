@@ -0,0 +1,172 @@
+package route_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCache(t *testing.T) {
+	Convey("测试响应缓存", t, func() {
+		var calls int
+		cache := route.NewCache(route.CacheConfig{TTL: time.Minute, Key: route.CacheKey("page")})
+		r := route.New()
+		r.Get("/orders", cache.Handle, func(ctx *route.Context) {
+			calls++
+			ctx.JSON(map[string]int{"calls": calls})
+		})
+		r.Get("/private", cache.Handle, func(ctx *route.Context) {
+			calls++
+			ctx.GetResponseWriter().Header().Set("Cache-Control", "private")
+			ctx.JSON("ok")
+		})
+		r.Get("/missing", cache.Handle, func(ctx *route.Context) {
+			calls++
+			ctx.Error(route.ErrNotFound)
+		})
+		r.Get("/lang", cache.Handle, func(ctx *route.Context) {
+			calls++
+			ctx.GetResponseWriter().Header().Set("Vary", "Accept-Language")
+			ctx.JSON(ctx.GetRequest().Header.Get("Accept-Language"))
+		})
+		r.Get("/any", cache.Handle, func(ctx *route.Context) {
+			calls++
+			ctx.GetResponseWriter().Header().Set("Vary", "*")
+			ctx.JSON("ok")
+		})
+		// 之前的中间件设置的响应头
+		r.Get("/session", func(ctx *route.Context) {
+			http.SetCookie(ctx.GetResponseWriter(), &http.Cookie{Name: "sid", Value: "1"})
+		}, cache.Handle, func(ctx *route.Context) {
+			calls++
+			ctx.JSON("ok")
+		})
+		r.Get("/user", func(ctx *route.Context) {
+			ctx.GetResponseWriter().Header().Set("Cache-Control", "private")
+		}, cache.Handle, func(ctx *route.Context) {
+			calls++
+			ctx.JSON("ok")
+		})
+
+		do := func(path string, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			for i := 0; i+1 < len(header); i += 2 {
+				req.Header.Set(header[i], header[i+1])
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := do("/orders?page=1&sort=id")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get(route.CacheHeader), ShouldEqual, "MISS")
+		tag := w.Header().Get("ETag")
+		So(tag, ShouldNotBeEmpty)
+
+		w = do("/ORDERS?sort=name&page=1")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get(route.CacheHeader), ShouldEqual, "HIT")
+		So(w.Header().Get("ETag"), ShouldEqual, tag)
+		So(w.Body.String(), ShouldEqual, `{"calls":1}`)
+		So(calls, ShouldEqual, 1)
+
+		Convey("If-None-Match 匹配时返回 304", func() {
+			w := do("/orders?page=1", "If-None-Match", `"other", `+tag)
+			So(w.Code, ShouldEqual, http.StatusNotModified)
+			So(w.Body.Len(), ShouldEqual, 0)
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("不同的参数分别缓存", func() {
+			w := do("/orders?page=2")
+			So(w.Header().Get(route.CacheHeader), ShouldEqual, "MISS")
+			So(calls, ShouldEqual, 2)
+		})
+
+		Convey("no-cache 刷新缓存", func() {
+			w := do("/orders?page=1", "Cache-Control", "no-cache")
+			So(w.Body.String(), ShouldEqual, `{"calls":2}`)
+			w = do("/orders?page=1")
+			So(w.Header().Get(route.CacheHeader), ShouldEqual, "HIT")
+			So(w.Body.String(), ShouldEqual, `{"calls":2}`)
+		})
+
+		Convey("按前缀失效", func() {
+			do("/orders?page=2")
+			So(cache.Invalidate("/orders"), ShouldEqual, 2)
+			w := do("/orders?page=1")
+			So(w.Header().Get(route.CacheHeader), ShouldEqual, "MISS")
+			So(calls, ShouldEqual, 3)
+		})
+
+		Convey("private 和错误响应不缓存", func() {
+			do("/private")
+			do("/private")
+			So(calls, ShouldEqual, 3)
+			So(do("/missing").Code, ShouldEqual, http.StatusNotFound)
+			So(do("/missing").Code, ShouldEqual, http.StatusNotFound)
+			So(calls, ShouldEqual, 5)
+		})
+
+		Convey("之前的中间件设置 Cookie 或 private 时不缓存", func() {
+			do("/session")
+			So(do("/session").Header().Get(route.CacheHeader), ShouldEqual, "MISS")
+			do("/user")
+			So(do("/user").Header().Get(route.CacheHeader), ShouldEqual, "MISS")
+			So(calls, ShouldEqual, 5)
+		})
+
+		Convey("按 Vary 的请求头分别缓存", func() {
+			So(do("/lang", "Accept-Language", "zh").Body.String(), ShouldEqual, `"zh"`)
+			So(do("/lang", "Accept-Language", "en").Body.String(), ShouldEqual, `"en"`)
+			w := do("/lang", "Accept-Language", "zh")
+			So(w.Header().Get(route.CacheHeader), ShouldEqual, "HIT")
+			So(w.Body.String(), ShouldEqual, `"zh"`)
+			w = do("/lang", "Accept-Language", "en")
+			So(w.Header().Get(route.CacheHeader), ShouldEqual, "HIT")
+			So(w.Body.String(), ShouldEqual, `"en"`)
+			So(calls, ShouldEqual, 3)
+
+			do("/any")
+			So(do("/any").Header().Get(route.CacheHeader), ShouldEqual, "MISS")
+			So(calls, ShouldEqual, 5)
+		})
+	})
+}
+
+func TestLRUCache(t *testing.T) {
+	Convey("测试 LRU 淘汰和过期", t, func() {
+		c := route.NewLRUCache(2, 1024)
+		set := func(key string, body []byte, ttl time.Duration) {
+			c.Set(key, &route.CachedResponse{Status: 200, Body: body, Expires: time.Now().Add(ttl)})
+		}
+		set("a", []byte("1"), time.Minute)
+		set("b", []byte("2"), time.Minute)
+		_, ok := c.Get("a")
+		So(ok, ShouldBeTrue)
+		set("c", []byte("3"), time.Minute)
+		_, ok = c.Get("b")
+		So(ok, ShouldBeFalse)
+		So(c.Len(), ShouldEqual, 2)
+
+		set("big", make([]byte, 2048), time.Minute)
+		_, ok = c.Get("big")
+		So(ok, ShouldBeFalse)
+
+		for i := 0; i < 3; i++ {
+			set("k"+strconv.Itoa(i), make([]byte, 400), time.Minute)
+		}
+		So(c.Len(), ShouldEqual, 2)
+
+		set("expired", []byte("x"), -time.Second)
+		_, ok = c.Get("expired")
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,124 @@
+package route
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/HiData-xyz/hit/metrics"
+)
+
+// coalesceGroupSize 每次合并的请求数, 包括实际执行方法链的请求
+var coalesceGroupSize = metrics.NewHistogram("hit_coalesce_group_size",
+	"合并执行的相同请求数", []float64{1, 2, 5, 10, 20, 50, 100, 200, 500}, "route")
+
+// CoalesceConfig 请求合并配置
+type CoalesceConfig struct {
+	// Headers 参与比较的请求头, 如 Accept、Accept-Language
+	Headers []string
+}
+
+// Coalesce 请求合并中间件, 用于热点 GET 接口
+//
+// 方法、路径、查询参数、Headers 指定的请求头和认证通过的调用方都相同的并发请求只执行一次方法链,
+// 其他请求等待并返回相同的响应; 执行方法链的请求 panic 或没有写入响应时, 等待的请求各自执行方法链
+func Coalesce(cfg CoalesceConfig) Handler {
+	c := &coalescer{cfg: cfg, flights: make(map[string]*flight)}
+	return c.handle
+}
+
+type coalescer struct {
+	cfg     CoalesceConfig
+	m       sync.Mutex
+	flights map[string]*flight
+}
+
+// flight 正在执行的请求
+type flight struct {
+	done    chan struct{}
+	waiters int
+	res     *bufferWriter // 为空时表示没有得到响应
+}
+
+func (c *coalescer) handle(ctx *Context) {
+	if ctx.r.Method != http.MethodGet && ctx.r.Method != http.MethodHead {
+		return
+	}
+	key := c.key(ctx)
+
+	c.m.Lock()
+	if f, ok := c.flights[key]; ok {
+		f.waiters++
+		c.m.Unlock()
+		c.wait(ctx, f)
+		return
+	}
+	f := &flight{done: make(chan struct{})}
+	c.flights[key] = f
+	c.m.Unlock()
+
+	w := ctx.w
+	bw := newBufferWriter()
+	ctx.w = bw
+	defer func() {
+		ctx.w = w
+		c.m.Lock()
+		delete(c.flights, key)
+		waiters := f.waiters
+		c.m.Unlock()
+		close(f.done)
+		coalesceGroupSize.Observe(float64(waiters+1), ctx.routeLabel())
+	}()
+	ctx.Next()
+	ctx.w = w
+
+	if bw.status != 0 {
+		f.res = bw
+	}
+	writeBuffered(w, bw)
+}
+
+// wait 等待执行中的请求并返回相同的响应
+func (c *coalescer) wait(ctx *Context, f *flight) {
+	select {
+	case <-f.done:
+	case <-ctx.r.Context().Done():
+		ctx.Abort()
+		return
+	}
+	if f.res == nil {
+		ctx.Next()
+		return
+	}
+	defer ctx.Stop()
+	ctx.written = true
+	writeBuffered(ctx.w, f.res)
+}
+
+// key 合并请求的 key
+func (c *coalescer) key(ctx *Context) string {
+	var b strings.Builder
+	b.WriteString(ctx.r.Method)
+	b.WriteByte(' ')
+	b.WriteString(strings.ToLower(ctx.r.URL.Path))
+	b.WriteByte('?')
+	b.WriteString(ctx.r.URL.Query().Encode())
+	for _, h := range c.cfg.Headers {
+		b.WriteByte('\n')
+		b.WriteString(h + ": " + strings.Join(ctx.r.Header.Values(h), ","))
+	}
+	b.WriteString("\nsub: " + ctx.Subject())
+	return b.String()
+}
+
+// writeBuffered 将缓存的响应写入 w, 响应头复制后写入, 不修改缓存的响应
+func writeBuffered(w http.ResponseWriter, bw *bufferWriter) {
+	h := w.Header()
+	for k, vs := range bw.header {
+		h[k] = append([]string(nil), vs...)
+	}
+	if bw.status != 0 {
+		w.WriteHeader(bw.status)
+	}
+	w.Write(bw.body.Bytes())
+}
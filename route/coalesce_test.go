@@ -0,0 +1,75 @@
+package route_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HiData-xyz/hit/metrics"
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCoalesce(t *testing.T) {
+	Convey("测试请求合并", t, func() {
+		var calls int32
+		started, release := make(chan struct{}), make(chan struct{})
+		r := route.New()
+		r.Get("/hot", route.Coalesce(route.CoalesceConfig{Headers: []string{"Accept-Language"}}), func(ctx *route.Context) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				close(started)
+				<-release
+			}
+			ctx.GetResponseWriter().Header().Set("X-Lang", ctx.GetRequest().Header.Get("Accept-Language"))
+			ctx.JSON(map[string]int32{"calls": calls})
+		})
+
+		do := func(lang string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/hot?id=1", nil)
+			req.Header.Set("Accept-Language", lang)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		const n = 10
+		results := make([]*httptest.ResponseRecorder, n)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[0] = do("zh")
+		}()
+		<-started
+		for i := 1; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = do("zh")
+			}(i)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		// 请求头不同的请求不合并
+		w := do("en")
+		So(w.Header().Get("X-Lang"), ShouldEqual, "en")
+		So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+
+		close(release)
+		wg.Wait()
+		So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+		for _, w := range results {
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("X-Lang"), ShouldEqual, "zh")
+			So(w.Body.String(), ShouldEqual, results[0].Body.String())
+		}
+
+		mw := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(mw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		So(mw.Body.String(), ShouldContainSubstring, `hit_coalesce_group_size_sum{route="/hot"} 11`)
+	})
+}
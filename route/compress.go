@@ -0,0 +1,249 @@
+package route
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompressConfig 响应压缩配置
+type CompressConfig struct {
+	Level     int // 压缩级别 1-9, 默认 gzip.DefaultCompression
+	MinLength int // 超过该长度的响应才压缩, 默认 1024 字节
+
+	// ContentTypes 需要压缩的内容类型, 以 '/' 结尾时按前缀匹配
+	// 默认 application/json、application/javascript、application/xml、image/svg+xml、text/
+	ContentTypes []string
+}
+
+// 支持的压缩方式, 按优先级排列
+var encodings = []string{"gzip", "deflate"}
+
+// Compress 响应压缩中间件, 根据 Accept-Encoding 使用 gzip 或 deflate 压缩响应
+//
+// 以下响应不压缩: 小于 MinLength、内容类型不匹配、已设置 Content-Encoding、
+// text/event-stream 以及没有 body 的响应
+func Compress(cfg CompressConfig) Handler {
+	if cfg.Level < gzip.BestSpeed || cfg.Level > gzip.BestCompression {
+		cfg.Level = gzip.DefaultCompression
+	}
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = 1024
+	}
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = []string{"application/json", "application/javascript", "application/xml", "image/svg+xml", "text/"}
+	}
+	c := &compressor{cfg: cfg}
+	c.pools = map[string]*sync.Pool{
+		"gzip": {New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(nil, cfg.Level)
+			return w
+		}},
+		"deflate": {New: func() interface{} {
+			w, _ := zlib.NewWriterLevel(nil, cfg.Level)
+			return w
+		}},
+	}
+	return c.handle
+}
+
+// compressor 压缩中间件的配置和压缩器缓存
+type compressor struct {
+	cfg   CompressConfig
+	pools map[string]*sync.Pool
+}
+
+// resetWriter gzip.Writer 和 zlib.Writer 的公共方法
+type resetWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+func (c *compressor) handle(ctx *Context) {
+	ctx.w.Header().Add("Vary", "Accept-Encoding")
+	if ctx.r.Method == http.MethodHead {
+		return
+	}
+	encoding := negotiateEncoding(ctx.r.Header.Get("Accept-Encoding"))
+	if encoding == "" {
+		return
+	}
+
+	w := ctx.w
+	cw := &compressWriter{ResponseWriter: w, c: c, encoding: encoding}
+	ctx.w = cw
+	defer func() {
+		ctx.w = w
+		cw.Close()
+	}()
+	ctx.Next()
+}
+
+// compressible 内容类型是否需要压缩
+func (c *compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "text/event-stream" {
+		return false
+	}
+	for _, t := range c.cfg.ContentTypes {
+		if mediaType == t || strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding 根据 Accept-Encoding 选择压缩方式, 不接受压缩时返回空字符串
+func negotiateEncoding(accept string) string {
+	if accept == "" {
+		return ""
+	}
+	q := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		name, weight := part, 1.0
+		if i := strings.Index(part, ";"); i >= 0 {
+			name = part[:i]
+			param := strings.TrimSpace(part[i+1:])
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					weight = f
+				}
+			}
+		}
+		q[strings.ToLower(strings.TrimSpace(name))] = weight
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range encodings {
+		weight, ok := q[enc]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && weight > bestQ {
+			best, bestQ = enc, weight
+		}
+	}
+	return best
+}
+
+// compressWriter 缓存响应开头的数据, 超过 MinLength 后决定是否压缩
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	zw      resetWriter // 为空时不压缩
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	// 没有 body 的状态码不需要等待数据
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf.Write(b)
+		if w.buf.Len() < w.c.cfg.MinLength {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide 决定是否压缩并写入响应头和缓存的数据
+// enough: 缓存的数据是否已达到 MinLength
+func (w *compressWriter) decide(enough bool) error {
+	if w.decided {
+		return nil
+	}
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	h := w.Header()
+	if enough && h.Get("Content-Encoding") == "" {
+		contentType := h.Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(w.buf.Bytes())
+			h.Set("Content-Type", contentType)
+		}
+		if w.c.compressible(contentType) {
+			zw := w.c.pools[w.encoding].Get().(resetWriter)
+			zw.Reset(w.ResponseWriter)
+			w.zw = zw
+			h.Set("Content-Encoding", w.encoding)
+			h.Del("Content-Length")
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.zw != nil {
+		_, err = w.zw.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// Flush 实现 http.Flusher 接口, 数据不足 MinLength 时不再压缩, 流式响应可以及时送达
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.zw != nil {
+		w.zw.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close 写入剩余的数据并回收压缩器
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.status == 0 && w.buf.Len() == 0 {
+			// 没有写入任何响应, 由 net/http 返回默认的响应
+			return nil
+		}
+		w.decide(false)
+	}
+	if w.zw == nil {
+		return nil
+	}
+	err := w.zw.Close()
+	w.zw.Reset(nil)
+	w.c.pools[w.encoding].Put(w.zw)
+	w.zw = nil
+	return err
+}
@@ -0,0 +1,98 @@
+package route_test
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompress(t *testing.T) {
+	Convey("测试响应压缩", t, func() {
+		large := strings.Repeat("hit", 1000)
+		r := route.New()
+		r.Use(route.Compress(route.CompressConfig{MinLength: 512}))
+		r.Get("/large", func(ctx *route.Context) { ctx.JSON(map[string]string{"data": large}) })
+		r.Get("/small", func(ctx *route.Context) { ctx.JSON("ok") })
+		r.Get("/png", func(ctx *route.Context) {
+			ctx.GetResponseWriter().Header().Set("Content-Type", "image/png")
+			ctx.GetResponseWriter().Write([]byte(large))
+		})
+		r.Get("/encoded", func(ctx *route.Context) {
+			ctx.GetResponseWriter().Header().Set("Content-Encoding", "br")
+			ctx.GetResponseWriter().Write([]byte(large))
+		})
+		r.Get("/sse", func(ctx *route.Context) {
+			w := ctx.GetResponseWriter()
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: 1\n\n"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("data: " + large + "\n\n"))
+		})
+
+		do := func(path, accept string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if accept != "" {
+				req.Header.Set("Accept-Encoding", accept)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		Convey("gzip", func() {
+			w := do("/large", "gzip, deflate")
+			So(w.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+			So(w.Header().Values("Vary"), ShouldContain, "Accept-Encoding")
+			So(w.Body.Len(), ShouldBeLessThan, len(large))
+			zr, err := gzip.NewReader(w.Body)
+			So(err, ShouldBeNil)
+			b, _ := ioutil.ReadAll(zr)
+			So(string(b), ShouldContainSubstring, large)
+		})
+
+		Convey("deflate", func() {
+			w := do("/large", "gzip;q=0.5, deflate")
+			So(w.Header().Get("Content-Encoding"), ShouldEqual, "deflate")
+			zr, err := zlib.NewReader(w.Body)
+			So(err, ShouldBeNil)
+			b, _ := ioutil.ReadAll(zr)
+			So(string(b), ShouldContainSubstring, large)
+		})
+
+		Convey("不压缩", func() {
+			for _, val := range []struct{ path, accept string }{
+				{"/large", ""},
+				{"/large", "gzip;q=0, br"},
+				{"/small", "gzip"},
+				{"/png", "gzip"},
+				{"/encoded", "gzip"},
+			} {
+				w := do(val.path, val.accept)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(w.Header().Get("Content-Encoding"), ShouldNotEqual, "gzip")
+				So(w.Body.String(), ShouldContainSubstring, map[string]string{"/large": large, "/small": "ok", "/png": large, "/encoded": large}[val.path])
+			}
+		})
+
+		Convey("SSE 不压缩", func() {
+			w := do("/sse", "gzip")
+			So(w.Header().Get("Content-Encoding"), ShouldBeEmpty)
+			So(w.Flushed, ShouldBeTrue)
+			So(w.Body.String(), ShouldStartWith, "data: 1\n\n")
+		})
+
+		Convey("错误响应", func() {
+			w := do("/none", "gzip")
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+			So(w.Header().Get("Content-Encoding"), ShouldBeEmpty)
+		})
+	})
+}
@@ -1,7 +1,6 @@
 package route
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -14,8 +13,10 @@ import (
 	"strings"
 	"sync/atomic"
 
+	"github.com/HiData-xyz/hit/hook"
 	xhttp "github.com/HiData-xyz/hit/http"
 	log "github.com/HiData-xyz/hit/log"
+	"github.com/HiData-xyz/hit/trace"
 
 	jwt "github.com/dgrijalva/jwt-go"
 )
@@ -30,6 +31,7 @@ func NewContext(w http.ResponseWriter, r *http.Request, route *Route) *Context {
 		r:     r,
 		val:   make(map[string]interface{}),
 		Route: route,
+		index: -1,
 	}
 }
 
@@ -43,12 +45,28 @@ type Context struct {
 
 	val map[string]interface{}
 
-	hooks  []*http.Request // 回调请求
-	stoped int32
+	hooks   []*hook.Hook // 回调请求
+	stoped  int32
+	written bool // 是否已写入响应
+
+	err error // 处理链方法执行过程中产生的错误信息
+
+	handles Handles // 方法链
+	index   int     // 当前执行的方法下标
+
+	claims  jwt.Claims // JWT 中间件校验通过的 claims
+	subject string     // claims 中的 sub
+
+	principal *Principal // 认证通过的调用方
+	clientIP  string     // IPFilter 解析得到的客户端IP
+	requestID string     // RequestID 中间件设置的请求ID
+	pattern   string     // 匹配的路由, 未匹配时为空
+	cspNonce  string     // Secure 中间件生成的 CSP nonce
+	csrfToken string     // CSRF 中间件生成或校验通过的令牌
 }
 
-// Hook 回调函数
-type Hook func(req *http.Request) error
+// Hook 回调函数, 调用时立即投递回调
+type Hook func() error
 
 func (ctx *Context) Context() context.Context {
 	return ctx.ctx
@@ -64,43 +82,78 @@ func (ctx *Context) SetToken(header string, base string, v interface{}) (string,
 	return sign, nil
 }
 
-// HTTPHook 生成HTTP回调
-func (ctx *Context) HTTPHook(url string, body interface{}) (h Hook, err error) {
-	b, err := json.Marshal(body)
+// SetTokenWithKeys 使用密钥集合的签名密钥签发令牌, 并设置到响应头 header
+func (ctx *Context) SetTokenWithKeys(header string, ks *KeySet, v jwt.Claims) (string, error) {
+	sign, err := ks.Sign(v)
 	if err != nil {
-		log.Error("序列化数据失败", "url", url, "err", err)
-		return
+		return "", err
 	}
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(b))
+	ctx.w.Header().Add(header, sign)
+	return sign, nil
+}
+
+// HTTPHook 生成HTTP回调, 调用返回的函数时立即投递, 失败时重试, 不写入 outbox
+func (ctx *Context) HTTPHook(url string, body interface{}, opts ...hook.OptionFunc) (h Hook, err error) {
+	_h, err := ctx.newHook(url, body, opts...)
 	if err != nil {
-		log.Error(ErrNewHTTPRequestFail.Error(), "url", url, "err", err)
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-	return func(req *http.Request) error {
-		err := xhttp.Do(req, 3, nil)
+	if _h.MaxAttempts == 0 {
+		_h.MaxAttempts = 3
+	}
+	d := ctx.Route.Dispatcher()
+	logger := ctx.Logger()
+	return func() error {
+		err := d.Do(_h)
 		if err != nil {
-			log.Error(ErrHookFailed.Error(), "url", req.URL.String(), "err", err)
+			logger.Error(ErrHookFailed.Error(), log.String("url", _h.URL), log.ZapError(err))
 			return err
 		}
 		return nil
 	}, nil
 }
 
-// SetHook 设置回调
-func (ctx *Context) SetHook(url string, body interface{}) {
-	b, err := json.Marshal(body)
+// SetHook 设置回调, 请求处理完成后写入 outbox, 由路由的回调投递器投递
+// opts 可以设置请求方法、请求头、超时时间、重试次数和视为成功的状态码
+func (ctx *Context) SetHook(url string, body interface{}, opts ...hook.OptionFunc) {
+	h, err := ctx.newHook(url, body, opts...)
 	if err != nil {
-		log.Error("序列化数据失败", "url", url, "err", err)
 		return
 	}
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(b))
+	ctx.hooks = append(ctx.hooks, h)
+}
+
+// newHook 生成以JSON格式发送 body 的回调请求, 携带当前请求的请求ID和追踪上下文
+func (ctx *Context) newHook(url string, body interface{}, opts ...hook.OptionFunc) (h *hook.Hook, err error) {
+	b, err := json.Marshal(body)
 	if err != nil {
-		log.Error(ErrNewHTTPRequestFail.Error(), "url", url, "err", err)
+		ctx.Logger().Error("序列化数据失败", log.String("url", url), log.ZapError(err))
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-	ctx.hooks = append(ctx.hooks, req)
+	h = hook.New(http.MethodPost, url, b, hook.Header("Content-Type", "application/json"))
+	if ctx.requestID != "" {
+		h.Header.Set(xhttp.RequestIDHeader, ctx.requestID)
+	}
+	// 投递回调时作为当前请求的子 Span
+	if sc, ok := trace.SpanContextFromContext(ctx.ctx); ok {
+		trace.Inject(h.Header, sc)
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	return
+}
+
+// Forward 将请求转发到 upstream, 保留请求路径, 流式返回上游服务的响应
+// 负载均衡、改写路径等需求使用 Proxy
+func (ctx *Context) Forward(upstream string) error {
+	p, err := NewProxy(ProxyConfig{Upstreams: []string{upstream}})
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	defer ctx.Stop()
+	return p.forward(ctx)
 }
 
 // SetValue 设置值, 非并发安全
@@ -118,6 +171,12 @@ func (ctx *Context) GetRequest() *http.Request {
 	return ctx.r
 }
 
+// GetResponseWriter 获取当前的响应, 经过中间件包装后可能不是原始的响应
+// 直接写入时需要自行设置 Content-Type, 流式响应可以断言为 http.Flusher
+func (ctx *Context) GetResponseWriter() http.ResponseWriter {
+	return ctx.w
+}
+
 // GetBody 获取请求body
 func (ctx *Context) GetBody(a interface{}) (err error) {
 	data, err := ctx.GetBodyBytes()
@@ -197,11 +256,52 @@ func (ctx *Context) EJSON(ecode int, a interface{}) (err error) {
 	return nil
 }
 
+// Error 交由路由的统一错误处理器处理错误, 并停止执行方法链
+func (ctx *Context) Error(err error) {
+	if err == nil {
+		return
+	}
+	defer ctx.Stop()
+	if ctx.err != nil {
+		return
+	}
+	ctx.err = err
+
+	h := DefaultErrorHandler
+	if ctx.Route != nil && ctx.Route.errHandler != nil {
+		h = ctx.Route.errHandler
+	}
+	h(ctx, err)
+}
+
+// Err 返回处理链方法执行过程中产生的错误
+func (ctx *Context) Err() error {
+	return ctx.err
+}
+
+// WriteError 按路由配置的错误格式返回错误
+func (ctx *Context) WriteError(he *HTTPError) (err error) {
+	format := ErrorFormatEnvelope
+	if ctx.Route != nil {
+		format = ctx.Route.errFormat
+	}
+	contentType, b, err := encodeError(format, he, ctx.r.URL.Path)
+	if err != nil {
+		return
+	}
+	return ctx.writeContent(he.Status, contentType, b)
+}
+
 func (ctx *Context) write(code int, b []byte) (err error) {
+	return ctx.writeContent(code, "application/json", b)
+}
+
+func (ctx *Context) writeContent(code int, contentType string, b []byte) (err error) {
 	defer ctx.Stop()
 
-	ctx.w.Header().Set("Content-Type", "application/json")
+	ctx.w.Header().Set("Content-Type", contentType)
 	ctx.w.WriteHeader(code)
+	ctx.written = true
 	_, err = ctx.w.Write(b)
 	if err != nil {
 		return
@@ -211,19 +311,21 @@ func (ctx *Context) write(code int, b []byte) (err error) {
 
 // Finish  公共处理
 func (ctx *Context) Finish() {
-	// 执行回调
-	for _, val := range ctx.hooks {
-		go func(req *http.Request) {
-			err := xhttp.Do(req, 3, nil)
-			if err != nil {
-				log.Error(ErrHookFailed.Error(), "url", req.URL.String(), "err", err)
-				return
-			}
-			log.Info("回调成功", "url", req.URL.String())
-		}(val)
+	// 回调写入 outbox 后再结束请求, 进程重启后不会丢失
+	if len(ctx.hooks) == 0 {
+		return
+	}
+	d := ctx.Route.Dispatcher()
+	for _, h := range ctx.hooks {
+		if err := d.Enqueue(h); err != nil {
+			ctx.Logger().Error(ErrHookFailed.Error(), log.String("url", h.URL), log.ZapError(err))
+		}
 	}
+}
 
-	return
+// Written 是否已写入响应
+func (ctx *Context) Written() bool {
+	return ctx.written
 }
 
 // Stop 停止执行方法链
@@ -231,6 +333,34 @@ func (ctx *Context) Stop() {
 	atomic.CompareAndSwapInt32(&ctx.stoped, 0, 1)
 }
 
+// Next 执行方法链中剩余的方法, 返回后可继续执行当前方法的后置逻辑
+// 未调用 Next 的方法返回后, 方法链同样会继续执行
+func (ctx *Context) Next() {
+	ctx.index++
+	for ctx.index < len(ctx.handles) {
+		if ctx.IsStop() {
+			return
+		}
+		ctx.handles[ctx.index](ctx)
+		ctx.index++
+	}
+}
+
+// Abort 停止执行方法链中剩余的方法, 不影响已执行方法的后置逻辑
+func (ctx *Context) Abort() {
+	ctx.Stop()
+}
+
+// AbortWithStatus 写入HTTP状态码并停止执行方法链
+func (ctx *Context) AbortWithStatus(code int) {
+	defer ctx.Abort()
+	if ctx.written {
+		return
+	}
+	ctx.w.WriteHeader(code)
+	ctx.written = true
+}
+
 // IsStop 是否停止
 func (ctx *Context) IsStop() bool {
 	return !atomic.CompareAndSwapInt32(&ctx.stoped, 0, 0)
@@ -266,7 +396,7 @@ func (ctx *Context) ParseFiles(dir string) (files []*os.File, err error) {
 			fileName = filepath.Join(dir, fileName)
 			dst, err := os.Create(fileName)
 			if err != nil {
-				log.Error("创建文件失败", "err", err.Error(), "path", fileName)
+				ctx.Logger().Error("创建文件失败", log.ZapError(err), log.String("path", fileName))
 				return nil, err
 			}
 			defer dst.Close()
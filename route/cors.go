@@ -0,0 +1,235 @@
+package route
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig 跨域配置
+type CORSConfig struct {
+	// AllowOrigins 允许的来源, 支持:
+	//  精确匹配 "https://example.com"
+	//  子域名通配 "https://*.example.com", 不匹配 "https://example.com"
+	//  全部来源 "*"
+	AllowOrigins []string
+	// AllowOriginPatterns 允许来源的正则表达式, 需要完整匹配 Origin
+	AllowOriginPatterns []string
+	// AllowOriginFunc 自定义来源校验, 返回 true 时允许
+	AllowOriginFunc func(origin string) bool
+
+	AllowMethods     []string      // 允许的方法, 默认 GET、HEAD、POST、PUT、PATCH、DELETE
+	AllowHeaders     []string      // 允许的请求头, "*" 允许全部请求头, 默认 Origin、Accept、Content-Type、Authorization
+	ExposeHeaders    []string      // 允许浏览器读取的响应头
+	AllowCredentials bool          // 是否允许携带 cookie 等凭证, 不能与 AllowOrigins 的 "*" 同时使用
+	MaxAge           time.Duration // 预检结果的缓存时间, 为 0 时不设置
+}
+
+// DefaultCORSConfig CORS 使用的配置, 允许全部来源
+var DefaultCORSConfig = CORSConfig{
+	AllowOrigins: []string{"*"},
+	AllowHeaders: []string{"*"},
+	MaxAge:       20 * 24 * time.Hour,
+}
+
+var defaultCORS = NewCORS(DefaultCORSConfig)
+
+// CORS 允许跨域, 使用 DefaultCORSConfig, 需要限制来源时使用 NewCORS
+func CORS(ctx *Context) {
+	defaultCORS(ctx)
+}
+
+// cors 预处理后的跨域配置
+type cors struct {
+	allowAll   bool
+	origins    map[string]bool
+	wildcards  [][2]string // 子域名通配的前缀和后缀
+	patterns   []*regexp.Regexp
+	originFunc func(string) bool
+
+	methods     map[string]bool
+	headers     map[string]bool
+	anyHeader   bool
+	credentials bool
+
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+// NewCORS 跨域中间件
+//
+// 来源不允许时, 普通请求不返回跨域响应头, 由浏览器拒绝读取响应; 预检请求返回 403
+// 预检请求的方法或请求头不允许时同样返回 403
+// 通过的预检请求返回 204, 不再执行后续方法
+// AllowOrigins 包含 "*" 且 AllowCredentials 为 true 时 panic, 任意来源都可以携带凭证读取响应
+func NewCORS(cfg CORSConfig) Handler {
+	c := &cors{
+		origins:     make(map[string]bool),
+		methods:     make(map[string]bool),
+		headers:     make(map[string]bool),
+		originFunc:  cfg.AllowOriginFunc,
+		credentials: cfg.AllowCredentials,
+	}
+	for _, o := range cfg.AllowOrigins {
+		o = strings.ToLower(o)
+		switch {
+		case o == "*":
+			c.allowAll = true
+		case strings.Contains(o, "://*."):
+			i := strings.Index(o, "*")
+			c.wildcards = append(c.wildcards, [2]string{o[:i], o[i+1:]})
+		default:
+			c.origins[o] = true
+		}
+	}
+	for _, p := range cfg.AllowOriginPatterns {
+		c.patterns = append(c.patterns, regexp.MustCompile("^(?:"+p+")$"))
+	}
+	if c.allowAll && c.credentials {
+		panic("route: CORS 允许全部来源时不能设置 AllowCredentials")
+	}
+
+	if len(cfg.AllowMethods) == 0 {
+		cfg.AllowMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	// 不修改调用方的切片
+	methods := make([]string, 0, len(cfg.AllowMethods))
+	for _, m := range cfg.AllowMethods {
+		m = strings.ToUpper(m)
+		methods = append(methods, m)
+		c.methods[m] = true
+	}
+	c.allowMethods = strings.Join(methods, ", ")
+
+	if len(cfg.AllowHeaders) == 0 {
+		cfg.AllowHeaders = []string{"Origin", "Accept", "Content-Type", TokenHeader}
+	}
+	for _, h := range cfg.AllowHeaders {
+		if h == "*" {
+			c.anyHeader = true
+			continue
+		}
+		c.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	if !c.anyHeader {
+		c.allowHeaders = strings.Join(cfg.AllowHeaders, ", ")
+	}
+
+	c.exposeHeaders = strings.Join(cfg.ExposeHeaders, ", ")
+	if cfg.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(cfg.MaxAge / time.Second))
+	}
+	return c.handle
+}
+
+func (c *cors) handle(ctx *Context) {
+	h := ctx.w.Header()
+	origin := ctx.r.Header.Get("Origin")
+	preflight := ctx.r.Method == http.MethodOptions && ctx.r.Header.Get("Access-Control-Request-Method") != ""
+
+	// 响应随 Origin 变化, 避免缓存返回其他来源的响应
+	h.Add("Vary", "Origin")
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+	}
+	if origin == "" {
+		return
+	}
+	if !c.allowOrigin(origin) {
+		if preflight {
+			ctx.AbortWithStatus(http.StatusForbidden)
+		}
+		return
+	}
+
+	if !preflight {
+		c.setOrigin(h, origin)
+		if c.exposeHeaders != "" {
+			h.Set("Access-Control-Expose-Headers", c.exposeHeaders)
+		}
+		return
+	}
+
+	method := strings.ToUpper(ctx.r.Header.Get("Access-Control-Request-Method"))
+	reqHeaders := parseHeaderList(ctx.r.Header.Values("Access-Control-Request-Headers"))
+	if !c.methods[method] || !c.allowHeader(reqHeaders) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	c.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", c.allowMethods)
+	if c.anyHeader {
+		if len(reqHeaders) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+		}
+	} else {
+		h.Set("Access-Control-Allow-Headers", c.allowHeaders)
+	}
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	ctx.AbortWithStatus(http.StatusNoContent)
+}
+
+// setOrigin 设置允许的来源, 允许凭证时不能使用 "*"
+func (c *cors) setOrigin(h http.Header, origin string) {
+	if c.allowAll && !c.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) allowOrigin(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	o := strings.ToLower(origin)
+	if c.origins[o] {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if len(o) > len(w[0])+len(w[1]) && strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) {
+			return true
+		}
+	}
+	for _, p := range c.patterns {
+		if p.MatchString(origin) {
+			return true
+		}
+	}
+	return c.originFunc != nil && c.originFunc(origin)
+}
+
+func (c *cors) allowHeader(headers []string) bool {
+	if c.anyHeader {
+		return true
+	}
+	for _, h := range headers {
+		if !c.headers[http.CanonicalHeaderKey(h)] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHeaderList 解析逗号分隔的请求头列表
+func parseHeaderList(values []string) (res []string) {
+	for _, v := range values {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				res = append(res, h)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,180 @@
+package route
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CSRF 令牌的校验方式
+const (
+	// CSRFDoubleSubmit 令牌保存在 cookie 中, 请求头或表单中的令牌需要与 cookie 一致
+	CSRFDoubleSubmit = "double-submit"
+	// CSRFSynchronizer 令牌使用 Secret 对会话 cookie 签名生成, 与会话绑定, 服务端不保存
+	CSRFSynchronizer = "synchronizer"
+)
+
+// ErrCSRFTokenInvalid CSRF 令牌缺失或不匹配
+var ErrCSRFTokenInvalid = NewHTTPError(http.StatusForbidden, http.StatusForbidden, "CSRF令牌无效")
+
+// CSRFConfig CSRF 防护配置
+type CSRFConfig struct {
+	Mode string // 校验方式, 默认 CSRFDoubleSubmit
+
+	CookieName string        // 双重提交使用的 cookie, 默认 csrf_token
+	HeaderName string        // 携带令牌的请求头, 默认 X-CSRF-Token
+	FormField  string        // 携带令牌的表单字段, 默认 csrf_token
+	CookiePath string        // 默认 "/"
+	MaxAge     time.Duration // cookie 有效期, 默认 12 小时
+	Secure     bool          // cookie 是否只在 HTTPS 中发送
+	SameSite   http.SameSite // 默认 http.SameSiteLaxMode
+
+	// Secret 同步令牌的签名密钥, CSRFSynchronizer 时必须设置
+	Secret []byte
+	// SessionCookie 同步令牌绑定的会话 cookie, CSRFSynchronizer 时必须设置
+	SessionCookie string
+
+	// ExemptPaths 不校验的路径前缀, 不区分大小写, 按路径段匹配, 如使用令牌认证的分组 "/api"
+	// 豁免 "/api" 和 "/api/..." 但不豁免 "/apix"
+	ExemptPaths []string
+	// Exempt 自定义豁免, 默认豁免已通过 JWT 或 APIKey 中间件认证的请求, 需要在认证中间件之后执行;
+	// 浏览器不会自动携带这些凭证, 跨站请求无法伪造; 只携带请求头而未认证的请求和 Basic 认证不豁免
+	Exempt func(ctx *Context) bool
+}
+
+// CSRF CSRF 防护中间件, 用于使用 cookie 认证的接口
+//
+// GET、HEAD、OPTIONS、TRACE 请求不校验, 生成令牌并通过 ctx.CSRFToken 和响应头 HeaderName 返回;
+// 其他请求需要在请求头 HeaderName 或表单字段 FormField 中携带令牌, 否则返回 403
+func CSRF(cfg CSRFConfig) Handler {
+	if cfg.Mode == "" {
+		cfg.Mode = CSRFDoubleSubmit
+	}
+	if cfg.Mode == CSRFSynchronizer && (len(cfg.Secret) == 0 || cfg.SessionCookie == "") {
+		panic("route: CSRFSynchronizer 需要设置 Secret 和 SessionCookie")
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "csrf_token"
+	}
+	if cfg.HeaderName == "" {
+		cfg.HeaderName = "X-CSRF-Token"
+	}
+	if cfg.FormField == "" {
+		cfg.FormField = "csrf_token"
+	}
+	if cfg.CookiePath == "" {
+		cfg.CookiePath = "/"
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 12 * time.Hour
+	}
+	if cfg.SameSite == 0 {
+		cfg.SameSite = http.SameSiteLaxMode
+	}
+	if cfg.Exempt == nil {
+		cfg.Exempt = tokenAuthenticated
+	}
+	c := &csrf{cfg: cfg}
+	return c.handle
+}
+
+type csrf struct {
+	cfg CSRFConfig
+}
+
+func (c *csrf) handle(ctx *Context) {
+	path := strings.ToLower(ctx.r.URL.Path)
+	for _, p := range c.cfg.ExemptPaths {
+		if hasPathPrefix(path, strings.ToLower(p)) {
+			return
+		}
+	}
+
+	switch ctx.r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		c.issue(ctx)
+		return
+	}
+	if c.cfg.Exempt(ctx) {
+		return
+	}
+
+	expected := c.expected(ctx)
+	got := ctx.r.Header.Get(c.cfg.HeaderName)
+	if got == "" {
+		got = ctx.r.PostFormValue(c.cfg.FormField)
+	}
+	if expected == "" || got == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(got)) != 1 {
+		ctx.Error(ErrCSRFTokenInvalid)
+		return
+	}
+	ctx.csrfToken = expected
+}
+
+// issue 生成或沿用令牌
+func (c *csrf) issue(ctx *Context) {
+	token := c.expected(ctx)
+	if token == "" && c.cfg.Mode == CSRFDoubleSubmit {
+		token = randomToken(32)
+		http.SetCookie(ctx.w, &http.Cookie{
+			Name:     c.cfg.CookieName,
+			Value:    token,
+			Path:     c.cfg.CookiePath,
+			MaxAge:   int(c.cfg.MaxAge / time.Second),
+			Secure:   c.cfg.Secure,
+			SameSite: c.cfg.SameSite,
+			// 前端需要读取 cookie 并放入请求头
+			HttpOnly: false,
+		})
+	}
+	if token == "" {
+		return
+	}
+	ctx.csrfToken = token
+	ctx.w.Header().Set(c.cfg.HeaderName, token)
+}
+
+// expected 当前请求应携带的令牌, 没有 cookie 时返回空字符串
+func (c *csrf) expected(ctx *Context) string {
+	if c.cfg.Mode == CSRFSynchronizer {
+		session, err := ctx.r.Cookie(c.cfg.SessionCookie)
+		if err != nil || session.Value == "" {
+			return ""
+		}
+		mac := hmac.New(sha256.New, c.cfg.Secret)
+		mac.Write([]byte(session.Value))
+		return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	cookie, err := ctx.r.Cookie(c.cfg.CookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// tokenAuthenticated 请求是否已通过 JWT 或 APIKey 中间件认证, 不包括 Basic 认证
+func tokenAuthenticated(ctx *Context) bool {
+	if ctx.Claims() != nil {
+		return true
+	}
+	p := ctx.Principal()
+	return p != nil && (p.Method == AuthJWT || p.Method == AuthAPIKey)
+}
+
+// hasPathPrefix path 是否以 prefix 为前缀, 按路径段匹配
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// CSRFToken 返回当前请求的 CSRF 令牌, 用于页面表单或前端请求头
+func (ctx *Context) CSRFToken() string {
+	return ctx.csrfToken
+}
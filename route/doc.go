@@ -5,5 +5,18 @@
 // 2.自动回调或者转发请求
 // 3.管理子服务(启动、停止)
 // 4.请求结果自动编码
+//
+// 中间件:
+// 方法链按 全局中间件(Route.Use) --> 分组中间件(Group, 外层分组在前) --> 路由处理方法 的顺序组成,
+// 方法内调用 ctx.Next() 先执行剩余的方法, 返回后继续执行后置逻辑, 形成洋葱模型:
+//
+//	r.Use(func(ctx *route.Context) {
+//		start := time.Now()
+//		ctx.Next()
+//		log.Info("耗时", log.Duration("cost", time.Since(start)))
+//	})
+//
+// 未调用 ctx.Next() 的方法返回后, 方法链继续执行; 调用 ctx.Abort()、ctx.AbortWithStatus()
+// 或写入响应(ctx.JSON、ctx.EJSON、ctx.Error)后, 剩余的方法不再执行, 已执行方法的后置逻辑不受影响.
 
 package route
@@ -1,8 +1,149 @@
 package route
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	log "github.com/HiData-xyz/hit/log"
+)
 
 // 常用错误
 var (
 	ErrReadRequestBodyFail = errors.New("read from request body failed")
 )
+
+// HTTPError 统一的HTTP错误模型
+type HTTPError struct {
+	Status  int         // HTTP状态码
+	Code    int         // 业务错误码
+	Message string      // 错误信息, 会返回给调用方
+	Details interface{} // 错误详情, 会返回给调用方
+	Err     error       // 原始错误, 只记录日志, 不返回给调用方
+}
+
+// NewHTTPError 返回一个HTTP错误
+func NewHTTPError(status, code int, msg string) *HTTPError {
+	return &HTTPError{
+		Status:  status,
+		Code:    code,
+		Message: msg,
+	}
+}
+
+// Error 实现 error 接口
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%d %d %s: %s", e.Status, e.Code, e.Message, e.Err.Error())
+	}
+	return fmt.Sprintf("%d %d %s", e.Status, e.Code, e.Message)
+}
+
+// Unwrap 返回原始错误
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails 返回携带错误详情的副本
+func (e *HTTPError) WithDetails(details interface{}) *HTTPError {
+	_e := *e
+	_e.Details = details
+	return &_e
+}
+
+// WithErr 返回携带原始错误的副本
+func (e *HTTPError) WithErr(err error) *HTTPError {
+	_e := *e
+	_e.Err = err
+	return &_e
+}
+
+// AsHTTPError 将任意错误转换成 HTTPError, 无法识别的错误视为服务器内部错误
+func AsHTTPError(err error) *HTTPError {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he
+	}
+	return ErrInternal.WithErr(err)
+}
+
+// 常用HTTP错误
+var (
+	ErrBadRequest   = NewHTTPError(http.StatusBadRequest, http.StatusBadRequest, "请求参数错误")
+	ErrUnauthorized = NewHTTPError(http.StatusUnauthorized, http.StatusUnauthorized, "未授权")
+	ErrForbidden    = NewHTTPError(http.StatusForbidden, http.StatusForbidden, "禁止访问")
+	ErrNotFound     = NewHTTPError(http.StatusNotFound, http.StatusNotFound, "页面不存在")
+	ErrInternal     = NewHTTPError(http.StatusInternalServerError, http.StatusInternalServerError, "服务器内部错误")
+)
+
+// ErrorFormat 错误返回格式
+type ErrorFormat int
+
+// 支持的错误返回格式
+const (
+	// ErrorFormatEnvelope 默认格式: {"code": 业务码, "msg": 错误信息, "details": 错误详情}
+	ErrorFormatEnvelope ErrorFormat = iota
+	// ErrorFormatProblem RFC 7807 application/problem+json
+	ErrorFormatProblem
+)
+
+// ErrorHandler 统一错误处理器
+type ErrorHandler func(ctx *Context, err error)
+
+// DefaultErrorHandler 默认的错误处理器, 记录服务端错误日志并按路由配置的格式返回
+func DefaultErrorHandler(ctx *Context, err error) {
+	he := AsHTTPError(err)
+	if he.Status >= http.StatusInternalServerError {
+		ctx.Logger().Error(he.Message,
+			log.String("method", ctx.r.Method),
+			log.String("path", ctx.r.URL.Path),
+			log.Int("status", he.Status),
+			log.Int("code", he.Code),
+			log.ZapError(err),
+		)
+	}
+	ctx.WriteError(he)
+}
+
+// envelope 默认错误格式
+type envelope struct {
+	Code    int         `json:"code"`
+	Msg     string      `json:"msg"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// problem RFC 7807 错误格式, code、details 为扩展字段
+type problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Code     int         `json:"code"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+// encodeError 按格式编码错误, 返回 Content-Type 和数据
+func encodeError(format ErrorFormat, he *HTTPError, instance string) (string, []byte, error) {
+	switch format {
+	case ErrorFormatProblem:
+		b, err := json.Marshal(problem{
+			Type:     "about:blank",
+			Title:    http.StatusText(he.Status),
+			Status:   he.Status,
+			Detail:   he.Message,
+			Instance: instance,
+			Code:     he.Code,
+			Details:  he.Details,
+		})
+		return "application/problem+json", b, err
+	default:
+		b, err := json.Marshal(envelope{
+			Code:    he.Code,
+			Msg:     he.Message,
+			Details: he.Details,
+		})
+		return "application/json", b, err
+	}
+}
@@ -0,0 +1,87 @@
+package route_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRouteError(t *testing.T) {
+	Convey("测试统一错误处理", t, func() {
+		r := route.New()
+		r.Get("/http", route.E(func(ctx *route.Context) error {
+			return route.NewHTTPError(http.StatusBadRequest, 10001, "参数缺失").WithDetails("id")
+		}))
+		r.Get("/plain", route.E(func(ctx *route.Context) error {
+			return errors.New("db down")
+		}))
+		r.Get("/ok", route.E(func(ctx *route.Context) error {
+			return ctx.JSON("ok")
+		}))
+
+		Convey("返回默认格式", func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/http", nil))
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+			var body map[string]interface{}
+			So(json.Unmarshal(w.Body.Bytes(), &body), ShouldBeNil)
+			So(body["code"], ShouldEqual, 10001)
+			So(body["msg"], ShouldEqual, "参数缺失")
+			So(body["details"], ShouldEqual, "id")
+		})
+
+		Convey("返回 RFC 7807 格式", func() {
+			r.SetErrorFormat(route.ErrorFormatProblem)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/http", nil))
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "application/problem+json")
+
+			var body map[string]interface{}
+			So(json.Unmarshal(w.Body.Bytes(), &body), ShouldBeNil)
+			So(body["status"], ShouldEqual, http.StatusBadRequest)
+			So(body["title"], ShouldEqual, http.StatusText(http.StatusBadRequest))
+			So(body["detail"], ShouldEqual, "参数缺失")
+			So(body["instance"], ShouldEqual, "/http")
+		})
+
+		Convey("未知错误视为服务器内部错误, 不返回原始错误", func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plain", nil))
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+			So(w.Body.String(), ShouldNotContainSubstring, "db down")
+		})
+
+		Convey("路由不存在", func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/none", nil))
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("自定义错误处理器", func() {
+			var got error
+			r.SetErrorHandler(func(ctx *route.Context, err error) {
+				got = err
+				ctx.WriteError(route.AsHTTPError(err))
+			})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plain", nil))
+			So(got, ShouldNotBeNil)
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+
+		Convey("处理成功不触发错误处理", func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+			So(w.Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
@@ -10,14 +10,14 @@ type Group struct {
 // Post 注册POST请求
 func (g *Group) Post(path string, h ...Handler) {
 	path = g.basePath + path
-	h = append(g.middles, h...)
+	h = combine(g.middles, h)
 	g.r.Post(path, h...)
 }
 
 // Get 注册Get请求
 func (g *Group) Get(path string, h ...Handler) {
 	path = g.basePath + path
-	h = append(g.middles, h...)
+	h = combine(g.middles, h)
 	g.r.Get(path, h...)
 }
 
@@ -25,7 +25,14 @@ func (g *Group) Get(path string, h ...Handler) {
 func (g *Group) New(path string, h ...Handler) *Group {
 	return &Group{
 		basePath: g.basePath + path,
-		middles:  append(g.middles, h...),
+		middles:  combine(g.middles, h),
 		r:        g.r,
 	}
 }
+
+// combine 合并方法链, 返回新的切片, 避免分组之间共享底层数组
+func combine(a, b Handles) Handles {
+	h := make(Handles, 0, len(a)+len(b))
+	h = append(h, a...)
+	return append(h, b...)
+}
@@ -1,6 +1,8 @@
 package route_test
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"github.com/HiData-xyz/hit/route"
 
@@ -47,3 +49,55 @@ func TestRouteGroup(t *testing.T) {
 		}
 	})
 }
+
+func TestMiddlewareOrder(t *testing.T) {
+	Convey("测试中间件执行顺序", t, func() {
+		var trace []string
+		mark := func(name string) route.Handler {
+			return func(ctx *route.Context) {
+				trace = append(trace, name+":before")
+				ctx.Next()
+				trace = append(trace, name+":after")
+			}
+		}
+
+		r := route.New()
+		r.Use(mark("global"))
+		g := r.Group("/api", mark("group"))
+		sub := g.New("/v1", mark("sub"))
+		sub.Get("/user", func(ctx *route.Context) {
+			trace = append(trace, "handler")
+		})
+		sub.Get("/abort", func(ctx *route.Context) {
+			ctx.AbortWithStatus(http.StatusTeapot)
+		}, func(ctx *route.Context) {
+			trace = append(trace, "unreachable")
+		})
+
+		Convey("洋葱模型", func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/user", nil))
+			So(trace, ShouldResemble, []string{
+				"global:before", "group:before", "sub:before",
+				"handler",
+				"sub:after", "group:after", "global:after",
+			})
+		})
+
+		Convey("Abort 后不再执行剩余方法, 后置逻辑照常执行", func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/abort", nil))
+			So(w.Code, ShouldEqual, http.StatusTeapot)
+			So(trace, ShouldNotContain, "unreachable")
+			So(trace[len(trace)-1], ShouldEqual, "global:after")
+		})
+
+		Convey("未调用 Next 的中间件", func() {
+			r.Use(func(ctx *route.Context) { trace = append(trace, "plain") })
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/user", nil))
+			So(trace, ShouldContain, "plain")
+			So(trace, ShouldContain, "handler")
+		})
+	})
+}
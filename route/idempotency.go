@@ -0,0 +1,413 @@
+package route
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	xhttp "github.com/HiData-xyz/hit/http"
+	"github.com/HiData-xyz/hit/log"
+)
+
+// IdempotencyHeader 幂等键请求头, http.PostTimes 重试时自动携带
+const IdempotencyHeader = xhttp.IdempotencyHeader
+
+// ReplayedHeader 重放保存的响应时返回的响应头
+const ReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLen 幂等键的最大长度
+const maxIdempotencyKeyLen = 255
+
+// 幂等键错误
+var (
+	ErrIdempotencyKeyRequired = NewHTTPError(http.StatusBadRequest, http.StatusBadRequest, "缺少幂等键")
+	ErrIdempotencyKeyInvalid  = NewHTTPError(http.StatusBadRequest, http.StatusBadRequest, "幂等键无效")
+	ErrIdempotencyInFlight    = NewHTTPError(http.StatusConflict, http.StatusConflict, "相同幂等键的请求正在处理")
+	ErrIdempotencyKeyReused   = NewHTTPError(http.StatusUnprocessableEntity, http.StatusUnprocessableEntity, "幂等键已用于不同的请求")
+	ErrRequestTooLarge        = NewHTTPError(http.StatusRequestEntityTooLarge, http.StatusRequestEntityTooLarge, "请求内容过大")
+)
+
+// IdempotentResponse 幂等键对应的请求状态和响应
+type IdempotentResponse struct {
+	Hash   string      `json:"hash"` // 请求 body 的摘要
+	Done   bool        `json:"done"` // 是否已处理完成, 为 false 时正在处理
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+	Exp    int64       `json:"exp"` // 过期时间, Unix 秒
+}
+
+// IdempotencyStore 幂等键的存储
+type IdempotencyStore interface {
+	// Begin 开始处理 key 对应的请求
+	// key 已存在时返回保存的记录, 否则保存处理中的记录直至 exp 并返回 nil
+	Begin(key, hash string, exp time.Time) (*IdempotentResponse, error)
+	// Complete 保存 key 对应的响应
+	Complete(key string, res *IdempotentResponse) error
+	// Release 删除处理中的记录, 客户端可以使用同一个幂等键重试
+	Release(key string) error
+}
+
+// MemoryIdempotency 内存存储, 过期的记录自动清理
+type MemoryIdempotency struct {
+	m     sync.Mutex
+	items map[string]*IdempotentResponse
+	sweep time.Time // 下次清理过期记录的时间
+}
+
+// NewMemoryIdempotency 返回内存存储
+func NewMemoryIdempotency() *MemoryIdempotency {
+	return &MemoryIdempotency{items: make(map[string]*IdempotentResponse)}
+}
+
+// Begin 实现 IdempotencyStore 接口
+func (s *MemoryIdempotency) Begin(key, hash string, exp time.Time) (*IdempotentResponse, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	now := time.Now()
+	s.purge(now)
+	return s.begin(key, hash, exp, now), nil
+}
+
+func (s *MemoryIdempotency) begin(key, hash string, exp, now time.Time) *IdempotentResponse {
+	if res, ok := s.items[key]; ok && res.Exp > now.Unix() {
+		return res
+	}
+	s.items[key] = &IdempotentResponse{Hash: hash, Exp: exp.Unix()}
+	return nil
+}
+
+// Complete 实现 IdempotencyStore 接口
+func (s *MemoryIdempotency) Complete(key string, res *IdempotentResponse) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.items[key] = res
+	return nil
+}
+
+// Release 实现 IdempotencyStore 接口, 只删除处理中的记录
+func (s *MemoryIdempotency) Release(key string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if res, ok := s.items[key]; ok && !res.Done {
+		delete(s.items, key)
+	}
+	return nil
+}
+
+// purge 每分钟最多清理一次过期的记录, 返回是否执行了清理
+func (s *MemoryIdempotency) purge(now time.Time) bool {
+	if now.Before(s.sweep) {
+		return false
+	}
+	s.sweep = now.Add(time.Minute)
+	for key, res := range s.items {
+		if res.Exp <= now.Unix() {
+			delete(s.items, key)
+		}
+	}
+	return true
+}
+
+// FileIdempotency 文件存储, 处理完成的响应追加一行记录, 打开时加载未过期的记录并改写文件
+// 处理中的记录只保存在内存中, 进程重启后客户端可以重试;
+// 清理过期记录时, 文件中的记录超过未过期记录的两倍则改写文件
+type FileIdempotency struct {
+	*MemoryIdempotency
+
+	path    string
+	fm      sync.Mutex // 守护 file 和 records, 写入文件时不持有 m, 需要同时持有时先获取 fm
+	file    *os.File
+	records int // 文件中的记录数
+}
+
+// idempotencyRecord 文件中的一行记录
+type idempotencyRecord struct {
+	Key string              `json:"key"`
+	Res *IdempotentResponse `json:"res"`
+}
+
+// NewFileIdempotency 打开或创建文件存储
+func NewFileIdempotency(path string) (s *FileIdempotency, err error) {
+	s = &FileIdempotency{
+		MemoryIdempotency: NewMemoryIdempotency(),
+		path:              path,
+	}
+	if err = s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 加载未过期的记录, 改写文件去除过期记录
+func (s *FileIdempotency) load() error {
+	now := time.Now().Unix()
+	f, err := os.Open(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16<<20)
+		for scanner.Scan() {
+			var rec idempotencyRecord
+			if json.Unmarshal(scanner.Bytes(), &rec) != nil || rec.Res == nil {
+				continue
+			}
+			if rec.Res.Exp > now {
+				s.items[rec.Key] = rec.Res
+			}
+		}
+		f.Close()
+		if err = scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return s.rewrite()
+}
+
+// rewrite 只保留处理完成且未过期的记录, 写入临时文件后替换, 需要持有 fm
+func (s *FileIdempotency) rewrite() error {
+	s.m.Lock()
+	records := make([]idempotencyRecord, 0, len(s.items))
+	for key, res := range s.items {
+		if res.Done {
+			records = append(records, idempotencyRecord{Key: key, Res: res})
+		}
+	}
+	s.m.Unlock()
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for i := range records {
+		if err = enc.Encode(&records[i]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.records = len(records)
+	return nil
+}
+
+// Begin 实现 IdempotencyStore 接口, 清理过期记录后按需改写文件
+func (s *FileIdempotency) Begin(key, hash string, exp time.Time) (*IdempotentResponse, error) {
+	s.m.Lock()
+	now := time.Now()
+	swept := s.purge(now)
+	res := s.begin(key, hash, exp, now)
+	s.m.Unlock()
+	if swept {
+		s.compact()
+	}
+	return res, nil
+}
+
+// compact 文件中的记录超过未过期记录的两倍时改写文件
+func (s *FileIdempotency) compact() {
+	s.fm.Lock()
+	defer s.fm.Unlock()
+	s.m.Lock()
+	n := len(s.items)
+	s.m.Unlock()
+	if s.file == nil || s.records < 2*n+1 {
+		return
+	}
+	if err := s.rewrite(); err != nil {
+		log.Error("改写幂等键文件失败", log.String("path", s.path), log.ZapError(err))
+	}
+}
+
+// Complete 实现 IdempotencyStore 接口, 写入文件后返回
+// 写入文件时只持有 fm, 不阻塞其他请求的 Begin
+func (s *FileIdempotency) Complete(key string, res *IdempotentResponse) error {
+	b, err := json.Marshal(&idempotencyRecord{Key: key, Res: res})
+	if err != nil {
+		return err
+	}
+
+	s.fm.Lock()
+	defer s.fm.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if _, err = s.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err = s.file.Sync(); err != nil {
+		return err
+	}
+	s.records++
+	// 持有 fm 时更新, 改写文件时不会遗漏已写入的记录
+	s.m.Lock()
+	s.items[key] = res
+	s.m.Unlock()
+	return nil
+}
+
+// Close 关闭文件
+func (s *FileIdempotency) Close() error {
+	s.fm.Lock()
+	defer s.fm.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// IdempotencyConfig 幂等键配置
+type IdempotencyConfig struct {
+	Store    IdempotencyStore // 幂等键存储, 默认 NewMemoryIdempotency()
+	TTL      time.Duration    // 保存响应的时间, 默认 24 小时
+	Required bool             // 是否必须携带幂等键, 为 false 时没有幂等键的请求直接处理
+	MaxBody  int64            // 请求 body 的最大长度, 超过时返回 413, 默认 1MB
+}
+
+// Idempotency 幂等键中间件, 用于 POST 等非幂等的接口, 需要在认证中间件之后执行
+//
+// 幂等键按调用方、请求方法和路径区分, 首次请求的响应保存 TTL 时间, 之后使用同一幂等键的请求直接返回保存的响应;
+// 首次请求仍在处理时返回 409, 幂等键已用于 body 不同的请求时返回 422;
+// 首次请求返回 5xx 或 panic 时不保存响应, 客户端可以使用同一幂等键重试
+func Idempotency(cfg IdempotencyConfig) Handler {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryIdempotency()
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.MaxBody <= 0 {
+		cfg.MaxBody = 1 << 20
+	}
+
+	return func(ctx *Context) {
+		idem := ctx.r.Header.Get(IdempotencyHeader)
+		if idem == "" {
+			if cfg.Required {
+				ctx.Error(ErrIdempotencyKeyRequired)
+			}
+			return
+		}
+		if len(idem) > maxIdempotencyKeyLen {
+			ctx.Error(ErrIdempotencyKeyInvalid)
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(ctx.r.Body, cfg.MaxBody+1))
+		if err != nil {
+			ctx.Error(ErrBadRequest.WithErr(err))
+			return
+		}
+		if int64(len(body)) > cfg.MaxBody {
+			ctx.Error(ErrRequestTooLarge)
+			return
+		}
+		ctx.r.Body.Close()
+		ctx.r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+
+		key := HashSecret(ctx.Subject() + "\n" + ctx.r.Method + " " + strings.ToLower(ctx.r.URL.Path) + "\n" + idem)
+		saved, err := cfg.Store.Begin(key, hash, time.Now().Add(cfg.TTL))
+		if err != nil {
+			ctx.Error(ErrInternal.WithErr(err))
+			return
+		}
+		if saved != nil {
+			switch {
+			case saved.Hash != hash:
+				ctx.Error(ErrIdempotencyKeyReused)
+			case !saved.Done:
+				ctx.Error(ErrIdempotencyInFlight)
+			default:
+				replay(ctx, saved)
+			}
+			return
+		}
+
+		w := ctx.w
+		bw := newBufferWriter()
+		ctx.w = bw
+		completed := false
+		defer func() {
+			ctx.w = w
+			if !completed {
+				// panic 时释放幂等键
+				cfg.Store.Release(key)
+			}
+		}()
+		ctx.Next()
+		ctx.w = w
+
+		completed = true
+		if bw.status == 0 || bw.status >= http.StatusInternalServerError {
+			cfg.Store.Release(key)
+		} else {
+			res := &IdempotentResponse{
+				Hash:   hash,
+				Done:   true,
+				Status: bw.status,
+				Header: bw.header.Clone(),
+				Body:   bw.body.Bytes(),
+				Exp:    time.Now().Add(cfg.TTL).Unix(),
+			}
+			if err := cfg.Store.Complete(key, res); err != nil {
+				cfg.Store.Release(key)
+				ctx.Logger().Error("保存幂等响应失败", log.ZapError(err))
+			}
+		}
+
+		h := w.Header()
+		for k, vs := range bw.header {
+			h[k] = vs
+		}
+		if bw.status != 0 {
+			w.WriteHeader(bw.status)
+		}
+		w.Write(bw.body.Bytes())
+	}
+}
+
+// replay 返回保存的响应
+func replay(ctx *Context, res *IdempotentResponse) {
+	defer ctx.Stop()
+	ctx.written = true
+	h := ctx.w.Header()
+	for k, vs := range res.Header {
+		h[k] = append([]string(nil), vs...)
+	}
+	h.Set(ReplayedHeader, "true")
+	ctx.w.WriteHeader(res.Status)
+	ctx.w.Write(res.Body)
+}
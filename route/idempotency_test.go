@@ -0,0 +1,161 @@
+package route_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	xhttp "github.com/HiData-xyz/hit/http"
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIdempotency(t *testing.T) {
+	Convey("测试幂等键", t, func() {
+		path := filepath.Join(t.TempDir(), "idempotency.log")
+		store, err := route.NewFileIdempotency(path)
+		So(err, ShouldBeNil)
+		defer store.Close()
+
+		var orders int32
+		started, block := make(chan struct{}), make(chan struct{})
+		r := route.New()
+		mw := route.Idempotency(route.IdempotencyConfig{Store: store, Required: true})
+		r.Post("/orders", mw, func(ctx *route.Context) {
+			if ctx.GetString("slow") != "" {
+				close(started)
+				<-block
+			}
+			n := atomic.AddInt32(&orders, 1)
+			ctx.GetResponseWriter().Header().Set("X-Order", "1")
+			ctx.EJSON(http.StatusCreated, map[string]int32{"order": n})
+		})
+		r.Post("/small", route.Idempotency(route.IdempotencyConfig{Store: store, MaxBody: 8}), func(ctx *route.Context) {
+			atomic.AddInt32(&orders, 1)
+			ctx.JSON("ok")
+		})
+		r.Post("/fail", mw, func(ctx *route.Context) {
+			atomic.AddInt32(&orders, 1)
+			ctx.Error(route.ErrInternal)
+		})
+
+		do := func(path, key, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			if key != "" {
+				req.Header.Set(route.IdempotencyHeader, key)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		So(do("/orders", "", `{}`).Code, ShouldEqual, http.StatusBadRequest)
+
+		w := do("/orders", "k1", `{"sku":1}`)
+		So(w.Code, ShouldEqual, http.StatusCreated)
+		So(w.Body.String(), ShouldEqual, `{"order":1}`)
+
+		w = do("/orders", "k1", `{"sku":1}`)
+		So(w.Code, ShouldEqual, http.StatusCreated)
+		So(w.Body.String(), ShouldEqual, `{"order":1}`)
+		So(w.Header().Get("X-Order"), ShouldEqual, "1")
+		So(w.Header().Get(route.ReplayedHeader), ShouldEqual, "true")
+		So(atomic.LoadInt32(&orders), ShouldEqual, 1)
+
+		So(do("/orders", "k1", `{"sku":2}`).Code, ShouldEqual, http.StatusUnprocessableEntity)
+
+		Convey("处理中返回 409", func() {
+			done := make(chan *httptest.ResponseRecorder)
+			go func() { done <- do("/orders?slow=1", "k2", `{}`) }()
+			<-started
+			So(do("/orders", "k2", `{}`).Code, ShouldEqual, http.StatusConflict)
+			close(block)
+			So((<-done).Code, ShouldEqual, http.StatusCreated)
+			So(do("/orders", "k2", `{}`).Header().Get(route.ReplayedHeader), ShouldEqual, "true")
+		})
+
+		Convey("5xx 响应不保存", func() {
+			So(do("/fail", "k3", `{}`).Code, ShouldEqual, http.StatusInternalServerError)
+			So(do("/fail", "k3", `{}`).Code, ShouldEqual, http.StatusInternalServerError)
+			So(atomic.LoadInt32(&orders), ShouldEqual, 3)
+		})
+
+		Convey("body 超过 MaxBody 时返回 413", func() {
+			So(do("/small", "k4", `{"sku":1}`).Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(do("/small", "k4", `{}`).Code, ShouldEqual, http.StatusOK)
+			So(atomic.LoadInt32(&orders), ShouldEqual, 2)
+		})
+
+		Convey("http.PostTimes 重试时携带同一个幂等键和 body", func() {
+			var attempts int32
+			keys := make(chan string, 2)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				keys <- req.Header.Get(route.IdempotencyHeader)
+				if atomic.AddInt32(&attempts, 1) == 1 {
+					// 首次请求处理完成后断开连接, 客户端收不到响应
+					r.ServeHTTP(httptest.NewRecorder(), req)
+					conn, _, _ := w.(http.Hijacker).Hijack()
+					conn.Close()
+					return
+				}
+				r.ServeHTTP(w, req)
+			}))
+			defer srv.Close()
+
+			var res map[string]int32
+			err := xhttp.PostTimes(srv.URL+"/orders", 3, map[string]int{"sku": 3}, &res)
+			So(err, ShouldBeNil)
+			So(res["order"], ShouldEqual, 2)
+			So(atomic.LoadInt32(&orders), ShouldEqual, 2)
+			So(<-keys, ShouldEqual, <-keys)
+		})
+
+		Convey("重新打开文件存储后重放响应", func() {
+			reopened, err := route.NewFileIdempotency(path)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+			r := route.New()
+			r.Post("/orders", route.Idempotency(route.IdempotencyConfig{Store: reopened}), func(ctx *route.Context) {
+				ctx.EJSON(http.StatusCreated, "new")
+			})
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"sku":1}`))
+			req.Header.Set(route.IdempotencyHeader, "k1")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			So(w.Body.String(), ShouldEqual, `{"order":1}`)
+		})
+	})
+}
+
+func TestFileIdempotencyCompact(t *testing.T) {
+	Convey("清理过期记录时改写文件", t, func() {
+		path := filepath.Join(t.TempDir(), "idempotency.log")
+		store, err := route.NewFileIdempotency(path)
+		So(err, ShouldBeNil)
+		defer store.Close()
+
+		expired := time.Now().Add(-time.Minute).Unix()
+		for _, key := range []string{"a", "b", "c"} {
+			So(store.Complete(key, &route.IdempotentResponse{Hash: key, Done: true, Status: http.StatusOK, Exp: expired}), ShouldBeNil)
+		}
+		b, _ := ioutil.ReadFile(path)
+		So(strings.Count(string(b), "\n"), ShouldEqual, 3)
+
+		// 首次 Begin 清理过期记录并改写文件, 处理中的记录不写入文件
+		res, err := store.Begin("d", "d", time.Now().Add(time.Minute))
+		So(err, ShouldBeNil)
+		So(res, ShouldBeNil)
+		b, _ = ioutil.ReadFile(path)
+		So(b, ShouldBeEmpty)
+
+		So(store.Complete("d", &route.IdempotentResponse{Hash: "d", Done: true, Status: http.StatusOK, Exp: time.Now().Add(time.Minute).Unix()}), ShouldBeNil)
+		b, _ = ioutil.ReadFile(path)
+		So(strings.Count(string(b), "\n"), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,97 @@
+package route
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	xhttp "github.com/HiData-xyz/hit/http"
+)
+
+// IPFilterConfig IP访问控制配置, 表达式语法与 http.ParseIP 相同, 同时支持IP6地址和 CIDR
+type IPFilterConfig struct {
+	Allow []string // 允许的IP表达式, 为空时允许除 Deny 外的全部IP
+	Deny  []string // 拒绝的IP表达式, 优先于 Allow
+
+	// TrustedProxies 可信代理的IP表达式
+	// 请求来自可信代理时, 从 X-Forwarded-For、X-Real-IP 中读取客户端IP
+	TrustedProxies []string
+}
+
+// IPFilter IP访问控制
+type IPFilter struct {
+	allow, deny, trusted *xhttp.IPSet
+}
+
+// NewIPFilter 返回IP访问控制, 表达式无效时返回 http.ErrInvaildIPAddr
+func NewIPFilter(cfg IPFilterConfig) (f *IPFilter, err error) {
+	f = new(IPFilter)
+	if f.allow, err = xhttp.NewIPSet(cfg.Allow...); err != nil {
+		return nil, err
+	}
+	if f.deny, err = xhttp.NewIPSet(cfg.Deny...); err != nil {
+		return nil, err
+	}
+	if f.trusted, err = xhttp.NewIPSet(cfg.TrustedProxies...); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Handle 中间件, 不允许的IP返回 403
+// 解析得到的客户端IP可以通过 ctx.ClientIP 获取
+func (f *IPFilter) Handle(ctx *Context) {
+	ip := f.RealIP(ctx.r)
+	if ip != nil {
+		ctx.clientIP = ip.String()
+	}
+	if !f.Allowed(ip) {
+		ctx.Error(ErrForbidden)
+	}
+}
+
+// Allowed ip 是否允许访问
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	if ip == nil || f.deny.Contains(ip) {
+		return false
+	}
+	return f.allow.Len() == 0 || f.allow.Contains(ip)
+}
+
+// RealIP 返回客户端IP
+// 直接连接的地址是可信代理时, 从右向左跳过 X-Forwarded-For 中的可信代理, 第一个不可信的地址即客户端IP;
+// 没有 X-Forwarded-For 时使用 X-Real-IP
+func (f *IPFilter) RealIP(r *http.Request) net.IP {
+	ip := net.ParseIP(clientIP(r))
+	if ip == nil || !f.trusted.Contains(ip) {
+		return ip
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				// 无法解析的地址不可信, 使用已确认的最后一跳
+				return ip
+			}
+			ip = hop
+			if !f.trusted.Contains(hop) {
+				return hop
+			}
+		}
+		return ip
+	}
+	if real := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); real != nil {
+		return real
+	}
+	return ip
+}
+
+// ClientIP 返回客户端IP, 使用 IPFilter 时为解析代理请求头后的地址, 否则为直接连接的地址
+func (ctx *Context) ClientIP() string {
+	if ctx.clientIP != "" {
+		return ctx.clientIP
+	}
+	return clientIP(ctx.r)
+}
@@ -0,0 +1,443 @@
+package route
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sync"
+	"time"
+
+	log "github.com/HiData-xyz/hit/log"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// 密钥相关错误
+var (
+	ErrKeyNotFound    = errors.New("找不到对应的密钥")
+	ErrKeyAlgMismatch = errors.New("令牌签名算法与密钥不匹配")
+	ErrNoSigningKey   = errors.New("没有设置签名密钥")
+	ErrUnsupportedKey = errors.New("不支持的密钥类型")
+)
+
+// SigningMethodEdDSA Ed25519 签名算法
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+type signingMethodEdDSA struct{}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(priv, []byte(signingString))), nil
+}
+
+// Key JWT 密钥
+type Key struct {
+	ID     string            // kid
+	Method jwt.SigningMethod // 签名算法
+
+	Public  interface{} // 验证签名使用: *rsa.PublicKey、*ecdsa.PublicKey、ed25519.PublicKey 或 HMAC 的 []byte
+	Private interface{} // 签名使用, 只用于验证的密钥为空
+}
+
+// NewKey 根据密钥类型返回 Key, 签名算法由密钥类型推断
+// key: *rsa.PrivateKey、*rsa.PublicKey、*ecdsa.PrivateKey、*ecdsa.PublicKey、
+// ed25519.PrivateKey、ed25519.PublicKey 或 HMAC 的 []byte
+func NewKey(kid string, key interface{}) (*Key, error) {
+	k := &Key{ID: kid}
+	switch key := key.(type) {
+	case []byte:
+		k.Method, k.Public, k.Private = jwt.SigningMethodHS256, key, key
+	case *rsa.PrivateKey:
+		k.Method, k.Public, k.Private = jwt.SigningMethodRS256, &key.PublicKey, key
+	case *rsa.PublicKey:
+		k.Method, k.Public = jwt.SigningMethodRS256, key
+	case *ecdsa.PrivateKey:
+		k.Public, k.Private = &key.PublicKey, key
+		k.Method = ecdsaMethod(key.Curve)
+	case *ecdsa.PublicKey:
+		k.Public = key
+		k.Method = ecdsaMethod(key.Curve)
+	case ed25519.PrivateKey:
+		k.Method, k.Public, k.Private = SigningMethodEdDSA, key.Public(), key
+	case ed25519.PublicKey:
+		k.Method, k.Public = SigningMethodEdDSA, key
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	if k.Method == nil {
+		return nil, ErrUnsupportedKey
+	}
+	return k, nil
+}
+
+func ecdsaMethod(curve elliptic.Curve) jwt.SigningMethod {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256
+	case elliptic.P384():
+		return jwt.SigningMethodES384
+	case elliptic.P521():
+		return jwt.SigningMethodES512
+	}
+	return nil
+}
+
+// KeySet JWT 密钥集合, 验证时按令牌头部的 kid 选择密钥
+// 从文件加载的密钥可以通过 Reload、Watch 重新加载, 用于密钥轮换
+type KeySet struct {
+	m       sync.RWMutex
+	keys    map[string]*Key // 当前生效的密钥
+	static  map[string]*Key // 直接添加的密钥, 重新加载时保留
+	sources []func(keys map[string]*Key) error
+	signing string // 签名使用的 kid
+}
+
+// NewKeySet 返回空的密钥集合
+func NewKeySet() *KeySet {
+	return &KeySet{
+		keys:   make(map[string]*Key),
+		static: make(map[string]*Key),
+	}
+}
+
+// HMACKeySet 返回只包含一个 HS256 密钥的集合, kid 为空
+func HMACKeySet(secret string) *KeySet {
+	ks := NewKeySet()
+	k, _ := NewKey("", []byte(secret))
+	ks.Add(k)
+	return ks
+}
+
+// Add 添加密钥, 包含私钥且尚未设置签名密钥时, 作为签名密钥
+func (ks *KeySet) Add(k *Key) {
+	ks.m.Lock()
+	defer ks.m.Unlock()
+	ks.static[k.ID] = k
+	ks.keys[k.ID] = k
+	if k.Private != nil && ks.signing == "" {
+		ks.signing = k.ID
+	}
+}
+
+// SetSigningKey 设置签名使用的 kid
+func (ks *KeySet) SetSigningKey(kid string) {
+	ks.m.Lock()
+	defer ks.m.Unlock()
+	ks.signing = kid
+}
+
+// Key 返回 kid 对应的密钥
+func (ks *KeySet) Key(kid string) (*Key, bool) {
+	ks.m.RLock()
+	defer ks.m.RUnlock()
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// LoadPEM 从 PEM 文件加载密钥, 支持 PKCS1、PKCS8、SEC1 私钥, PKIX 公钥和证书
+func (ks *KeySet) LoadPEM(kid, path string) error {
+	return ks.addSource(func(keys map[string]*Key) error {
+		k, err := readPEM(kid, path)
+		if err != nil {
+			return err
+		}
+		keys[kid] = k
+		return nil
+	})
+}
+
+// LoadJWKS 从本地 JWKS 文件加载密钥
+func (ks *KeySet) LoadJWKS(path string) error {
+	return ks.addSource(func(keys map[string]*Key) error {
+		_keys, err := readJWKS(path)
+		if err != nil {
+			return err
+		}
+		for _, k := range _keys {
+			keys[k.ID] = k
+		}
+		return nil
+	})
+}
+
+// addSource 添加密钥来源并立即加载
+func (ks *KeySet) addSource(src func(keys map[string]*Key) error) error {
+	ks.m.Lock()
+	defer ks.m.Unlock()
+	keys := make(map[string]*Key)
+	if err := src(keys); err != nil {
+		return err
+	}
+	ks.sources = append(ks.sources, src)
+	for kid, k := range keys {
+		ks.keys[kid] = k
+	}
+	return nil
+}
+
+// Reload 重新加载全部文件, 任一文件加载失败时保留原有密钥
+func (ks *KeySet) Reload() error {
+	ks.m.RLock()
+	sources := ks.sources
+	keys := make(map[string]*Key, len(ks.keys))
+	for kid, k := range ks.static {
+		keys[kid] = k
+	}
+	ks.m.RUnlock()
+
+	for _, src := range sources {
+		if err := src(keys); err != nil {
+			return err
+		}
+	}
+
+	ks.m.Lock()
+	defer ks.m.Unlock()
+	ks.keys = keys
+	return nil
+}
+
+// Watch 每隔 interval 重新加载文件, 直到 ctx 结束
+func (ks *KeySet) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Reload(); err != nil {
+				log.Error("重新加载密钥失败", log.ZapError(err))
+			}
+		}
+	}
+}
+
+// Keyfunc 实现 jwt.Keyfunc, 按 kid 选择密钥并校验签名算法
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := ks.Key(kid)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	// 防止使用公钥作为 HMAC 密钥等算法混淆攻击
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, ErrKeyAlgMismatch
+	}
+	return k.Public, nil
+}
+
+// Sign 使用签名密钥签发令牌, 令牌头部携带 kid
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	ks.m.RLock()
+	k, ok := ks.keys[ks.signing]
+	ks.m.RUnlock()
+	if !ok || k.Private == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(k.Method, claims)
+	if k.ID != "" {
+		token.Header["kid"] = k.ID
+	}
+	return token.SignedString(k.Private)
+}
+
+// readPEM 读取 PEM 文件中的第一个密钥
+func readPEM(kid, path string) (*Key, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(kid, key)
+}
+
+// jwk JWKS 中的一个密钥
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+
+	N string `json:"n"` // RSA
+	E string `json:"e"`
+	X string `json:"x"` // EC、OKP
+	Y string `json:"y"`
+	D string `json:"d"` // 私钥
+	K string `json:"k"` // oct
+}
+
+// readJWKS 读取 JWKS 文件, 跳过非签名用途和不支持的密钥
+func readJWKS(path string) (keys []*Key, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return
+	}
+
+	for _, val := range set.Keys {
+		if val.Use != "" && val.Use != "sig" {
+			continue
+		}
+		key, err := val.key()
+		if err != nil {
+			log.Error("解析JWKS密钥失败", log.String("kid", val.Kid), log.ZapError(err))
+			continue
+		}
+		k, err := NewKey(val.Kid, key)
+		if err != nil {
+			continue
+		}
+		if m := jwt.GetSigningMethod(val.Alg); val.Alg != "" && m != nil {
+			k.Method = m
+		}
+		keys = append(keys, k)
+	}
+	return
+}
+
+// key 转换成 NewKey 支持的密钥类型
+func (k *jwk) key() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		// RSA 私钥使用 PEM 文件加载, 这里只读取公钥
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrUnsupportedKey
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if k.D == "" {
+			return &pub, nil
+		}
+		d, err := decodeBigInt(k.D)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PrivateKey{PublicKey: pub, D: d}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, ErrUnsupportedKey
+		}
+		if k.D != "" {
+			seed, err := base64.RawURLEncoding.DecodeString(k.D)
+			if err != nil {
+				return nil, err
+			}
+			return ed25519.NewKeyFromSeed(seed), nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, ErrUnsupportedKey
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,57 @@
+package route
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HiData-xyz/hit/metrics"
+)
+
+// notFoundRoute 未注册路由的请求使用的 route 标签, 避免按请求路径产生过多的序列
+const notFoundRoute = "NotFound"
+
+// otherMethod 非标准请求方法使用的 method 标签, 避免按客户端传入的方法产生过多的序列
+const otherMethod = "OTHER"
+
+// 路由内置的指标
+var (
+	requestsTotal = metrics.NewCounter("hit_http_requests_total",
+		"按路由和状态码统计的请求数", "method", "route", "status")
+	requestDuration = metrics.NewHistogram("hit_http_request_duration_seconds",
+		"按路由统计的请求耗时", metrics.DefBuckets, "method", "route")
+)
+
+// observeRequest 记录请求数和耗时
+func observeRequest(ctx *Context, sw *statusWriter, start time.Time) {
+	route, method := ctx.routeLabel(), ctx.methodLabel()
+	requestsTotal.Inc(method, route, strconv.Itoa(sw.Status()))
+	requestDuration.ObserveSince(start, method, route)
+}
+
+// routeLabel 指标中的 route 标签, 使用注册路由时的路径
+func (ctx *Context) routeLabel() string {
+	if ctx.pattern == "" {
+		return notFoundRoute
+	}
+	return ctx.pattern
+}
+
+// methodLabel 指标中的 method 标签, 非标准的请求方法统一为 OTHER
+func (ctx *Context) methodLabel() string {
+	switch m := ctx.r.Method; m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	}
+	return otherMethod
+}
+
+// Metrics 以 Prometheus 文本格式输出 metrics.Default 中的指标
+//
+//	r.Get("/metrics", route.Metrics)
+func Metrics(ctx *Context) {
+	defer ctx.Stop()
+	ctx.written = true
+	metrics.Handler().ServeHTTP(ctx.w, ctx.r)
+}
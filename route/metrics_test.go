@@ -0,0 +1,43 @@
+package route_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HiData-xyz/hit/metrics"
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("测试路由指标", t, func() {
+		r := route.New()
+		r.Get("/metrics", route.Metrics)
+		g := r.Group("/api/v1")
+		g.Get("/Orders", func(ctx *route.Context) {
+			ctx.JSON("ok")
+		})
+
+		for _, path := range []string{"/api/v1/orders", "/API/V1/ORDERS", "/api/v1/unknown"} {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+		// 非标准的请求方法
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("X-RANDOM-1", "/api/v1/orders", nil))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldEqual, metrics.ContentType)
+
+		body := w.Body.String()
+		So(body, ShouldContainSubstring, `hit_http_requests_total{method="GET",route="/api/v1/Orders",status="200"} 2`)
+		So(body, ShouldContainSubstring, `hit_http_requests_total{method="GET",route="NotFound",status="404"}`)
+		So(body, ShouldContainSubstring, `hit_http_request_duration_seconds_count{method="GET",route="/api/v1/Orders"} 2`)
+		So(body, ShouldNotContainSubstring, "unknown")
+		So(body, ShouldContainSubstring, `hit_http_requests_total{method="OTHER",route="NotFound",status="404"}`)
+		So(body, ShouldNotContainSubstring, "X-RANDOM-1")
+		So(body, ShouldContainSubstring, `hit_pool_workers{pool="default"}`)
+	})
+}
@@ -1,63 +1,42 @@
 package route
 
 import (
+	"bytes"
 	"errors"
-	"fmt"
+	"io/ioutil"
 	"net/http"
-	"reflect"
-	"strings"
-	"github.com/HiData-xyz/hit/log"
-
-	"github.com/dgrijalva/jwt-go"
+	"time"
+	"github.com/HiData-xyz/hit/hook"
 )
 
-// CORS 运行跨域
-func CORS(ctx *Context) {
-	log.Info(fmt.Sprintf("request header: %+v", ctx.r.Header.Get("origin")))
-	ctx.w.Header().Set("Access-Control-Allow-Origin", ctx.r.Header.Get("Origin"))
-	if ctx.r.Method == http.MethodOptions {
-		ctx.w.Header().Set("Access-Control-Allow-Headers", strings.Join(ctx.r.Header["Access-Control-Request-Headers"], ","))
-		ctx.w.Header().Set("Access-Control-Allow-Methods", strings.Join(ctx.r.Header["Access-Control-Request-Method"], ","))
-		ctx.w.Header().Set("Access-Control-Max-Age", "1728000")
-		ctx.w.WriteHeader(204)
-		ctx.Stop()
-	}
-	return
-}
-
 var ErrInvalidToken = errors.New("token checked is failed")
 
-// Token 中间件
+// Token 中间件, 使用 HS256 和共享密钥 base 校验 header 中的令牌
+// 需要非对称算法、多密钥或校验 iss、aud 时使用 JWT
 func Token(header string, base string, v interface{}) Handler {
-	typ := reflect.TypeOf(v)
-	if typ.Kind() == reflect.Ptr {
-		typ = typ.Elem()
-	}
+	return JWT(TokenConfig{Header: header, Keys: HMACKeySet(base)}, v)
+}
 
-	v = reflect.New(typ).Interface()
+// ErrInvalidSignature 签名校验失败
+var ErrInvalidSignature = NewHTTPError(http.StatusUnauthorized, http.StatusUnauthorized, "签名校验失败")
 
+// VerifySignature 校验回调签名的中间件, 与 Route.SetHookSecrets 使用相同的签名方案
+// window: 允许的时间戳误差, 超出视为重放请求
+// secrets: 签名密钥, 轮换密钥期间可同时设置新旧密钥
+func VerifySignature(window time.Duration, secrets ...string) Handler {
 	return func(ctx *Context) {
-		token := ctx.r.Header.Get(header)
-		if token == "" {
-			ctx.EJSON(http.StatusUnauthorized, ErrInvalidToken.Error())
-			ctx.Stop()
+		body, err := ctx.GetBodyBytes()
+		if err != nil {
+			ctx.Error(ErrBadRequest.WithErr(err))
 			return
 		}
+		// 还原 body, 后续方法可以继续读取
+		ctx.r.Body = ioutil.NopCloser(bytes.NewReader(body))
 
-		_v := v.(jwt.Claims)
-		_token, err := jwt.ParseWithClaims(token, _v, func(token *jwt.Token) (v interface{}, err error) {
-			return []byte(base), nil
-		})
+		err = hook.Verify(ctx.r.Header.Get(hook.SignatureHeader), body, time.Now(), window, secrets...)
 		if err != nil {
-			ctx.EJSON(http.StatusBadRequest, err.Error())
-			ctx.Stop()
-			return
-		}
-		if !_token.Valid {
-			ctx.EJSON(http.StatusUnauthorized, ErrInvalidToken.Error())
-			ctx.Stop()
+			ctx.Error(ErrInvalidSignature.WithErr(err))
 			return
 		}
-		ctx.SetValue("token", _token.Claims)
 	}
 }
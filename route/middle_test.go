@@ -0,0 +1,295 @@
+package route_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/HiData-xyz/hit/hook"
+	xhttp "github.com/HiData-xyz/hit/http"
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifySignature(t *testing.T) {
+	Convey("测试回调签名校验", t, func() {
+		received := make(chan string, 1)
+		receiver := route.New()
+		receiver.Post("/hook", route.VerifySignature(time.Minute, "secret"), func(ctx *route.Context) {
+			b, _ := ctx.GetBodyBytes()
+			received <- string(b)
+			ctx.JSON("ok")
+		})
+
+		Convey("签名正确", func() {
+			body := []byte(`{"id":1}`)
+			req := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(body))
+			req.Header.Set(hook.SignatureHeader, hook.Signature(time.Now(), body, "secret"))
+			w := httptest.NewRecorder()
+			receiver.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(<-received, ShouldEqual, `{"id":1}`)
+		})
+
+		Convey("签名错误或缺失", func() {
+			body := []byte(`{"id":1}`)
+			req := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(body))
+			req.Header.Set(hook.SignatureHeader, hook.Signature(time.Now(), body, "other"))
+			w := httptest.NewRecorder()
+			receiver.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+
+			w = httptest.NewRecorder()
+			receiver.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(body)))
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("发送方签名, 接收方校验", func() {
+			svr := httptest.NewServer(receiver)
+			defer svr.Close()
+
+			sender := route.New()
+			sender.SetHookSecrets("secret")
+			sender.Post("/order", func(ctx *route.Context) {
+				ctx.SetHook(svr.URL+"/hook", map[string]int{"id": 2})
+				ctx.JSON("ok")
+			})
+			sender.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/order", nil))
+
+			select {
+			case body := <-received:
+				So(body, ShouldEqual, `{"id":2}`)
+			case <-time.After(3 * time.Second):
+				So("回调超时", ShouldBeEmpty)
+			}
+		})
+	})
+}
+
+func TestCORS(t *testing.T) {
+	Convey("测试跨域配置", t, func() {
+		r := route.New()
+		r.Use(route.NewCORS(route.CORSConfig{
+			AllowOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+			AllowOriginPatterns: []string{`https://dev-\d+\.example\.net`},
+			AllowMethods:        []string{"GET", "POST"},
+			AllowHeaders:        []string{"Content-Type", "X-Custom"},
+			ExposeHeaders:       []string{"X-Total"},
+			AllowCredentials:    true,
+			MaxAge:              time.Hour,
+		}))
+		r.Get("/data", func(ctx *route.Context) { ctx.JSON("ok") })
+
+		do := func(method, origin string, header map[string]string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/data", nil)
+			if origin != "" {
+				req.Header.Set("Origin", origin)
+			}
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		Convey("允许的来源", func() {
+			for _, origin := range []string{"https://app.example.com", "https://a.example.org", "https://dev-12.example.net"} {
+				w := do(http.MethodGet, origin, nil)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, origin)
+				So(w.Header().Get("Access-Control-Allow-Credentials"), ShouldEqual, "true")
+				So(w.Header().Get("Access-Control-Expose-Headers"), ShouldEqual, "X-Total")
+				So(w.Header().Values("Vary"), ShouldContain, "Origin")
+			}
+		})
+
+		Convey("不允许的来源", func() {
+			for _, origin := range []string{"https://evil.com", "https://example.org", "https://dev-x.example.net"} {
+				w := do(http.MethodGet, origin, nil)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(w.Header().Get("Access-Control-Allow-Origin"), ShouldBeEmpty)
+				So(w.Header().Values("Vary"), ShouldContain, "Origin")
+			}
+		})
+
+		Convey("预检请求", func() {
+			w := do(http.MethodOptions, "https://app.example.com", map[string]string{
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type, x-custom",
+			})
+			So(w.Code, ShouldEqual, http.StatusNoContent)
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://app.example.com")
+			So(w.Header().Get("Access-Control-Allow-Methods"), ShouldEqual, "GET, POST")
+			So(w.Header().Get("Access-Control-Allow-Headers"), ShouldEqual, "Content-Type, X-Custom")
+			So(w.Header().Get("Access-Control-Max-Age"), ShouldEqual, "3600")
+
+			w = do(http.MethodOptions, "https://evil.com", map[string]string{"Access-Control-Request-Method": "POST"})
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldBeEmpty)
+
+			w = do(http.MethodOptions, "https://app.example.com", map[string]string{"Access-Control-Request-Method": "DELETE"})
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+
+			w = do(http.MethodOptions, "https://app.example.com", map[string]string{
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "X-Other",
+			})
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("不修改配置中的切片", func() {
+			methods := []string{"get", "post"}
+			route.NewCORS(route.CORSConfig{AllowMethods: methods})
+			So(methods, ShouldResemble, []string{"get", "post"})
+		})
+
+		Convey("允许全部来源时不能携带凭证", func() {
+			So(func() {
+				route.NewCORS(route.CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true})
+			}, ShouldPanic)
+		})
+
+		Convey("默认配置允许全部来源", func() {
+			r := route.New()
+			r.Use(route.CORS)
+			r.Get("/data", func(ctx *route.Context) { ctx.JSON("ok") })
+			req := httptest.NewRequest(http.MethodOptions, "/data", nil)
+			req.Header.Set("Origin", "https://any.com")
+			req.Header.Set("Access-Control-Request-Method", "PUT")
+			req.Header.Set("Access-Control-Request-Headers", "X-Anything")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusNoContent)
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "*")
+			So(w.Header().Get("Access-Control-Allow-Headers"), ShouldEqual, "X-Anything")
+		})
+	})
+}
+
+func TestIPFilter(t *testing.T) {
+	Convey("测试IP访问控制", t, func() {
+		f, err := route.NewIPFilter(route.IPFilterConfig{
+			Allow:          []string{"192.168.0.10-13", "10.0.0.0/8", "2001:db8::/32"},
+			Deny:           []string{"10.0.0.[1-2]"},
+			TrustedProxies: []string{"172.16.0.1", "172.16.0.2"},
+		})
+		So(err, ShouldBeNil)
+
+		r := route.New()
+		r.Use(f.Handle)
+		r.Get("/", func(ctx *route.Context) { ctx.JSON(ctx.ClientIP()) })
+
+		do := func(addr string, header map[string]string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = addr
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		Convey("直接连接", func() {
+			So(do("192.168.0.12:80", nil).Code, ShouldEqual, http.StatusOK)
+			So(do("192.168.0.14:80", nil).Code, ShouldEqual, http.StatusForbidden)
+			So(do("10.9.8.7:80", nil).Code, ShouldEqual, http.StatusOK)
+			So(do("10.0.0.2:80", nil).Code, ShouldEqual, http.StatusForbidden)
+			So(do("10.0.0.3:80", nil).Code, ShouldEqual, http.StatusOK)
+			So(do("[2001:db8::1]:80", nil).Code, ShouldEqual, http.StatusOK)
+			So(do("[2001:db9::1]:80", nil).Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("不可信的代理请求头", func() {
+			w := do("192.168.0.99:80", map[string]string{"X-Forwarded-For": "192.168.0.10"})
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+			w = do("10.0.0.3:80", map[string]string{"X-Real-IP": "192.168.0.99"})
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldContainSubstring, "10.0.0.3")
+		})
+
+		Convey("可信代理", func() {
+			w := do("172.16.0.1:80", map[string]string{"X-Forwarded-For": "1.2.3.4, 192.168.0.11, 172.16.0.2"})
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldContainSubstring, "192.168.0.11")
+
+			So(do("172.16.0.1:80", map[string]string{"X-Forwarded-For": "10.0.0.1"}).Code, ShouldEqual, http.StatusForbidden)
+			So(do("172.16.0.1:80", map[string]string{"X-Real-IP": "2001:db8::5"}).Code, ShouldEqual, http.StatusOK)
+			So(do("172.16.0.1:80", nil).Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("无效的表达式", func() {
+			_, err := route.NewIPFilter(route.IPFilterConfig{Allow: []string{"192.168.0"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	Convey("测试请求ID", t, func() {
+		ids := make(chan string, 6)
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ids <- r.Header.Get(xhttp.RequestIDHeader)
+			w.Write([]byte(`{}`))
+		}))
+		defer backend.Close()
+
+		r := route.New()
+		r.Use(route.RequestID)
+		r.Get("/", func(ctx *route.Context) { ctx.JSON(ctx.RequestID()) })
+		r.Get("/call", func(ctx *route.Context) {
+			var res map[string]interface{}
+			if err := ctx.Client().Get(backend.URL, &res); err != nil {
+				ctx.Error(err)
+				return
+			}
+			if err := ctx.Client().Post(backend.URL, map[string]int{"id": 1}, &res); err != nil {
+				ctx.Error(err)
+				return
+			}
+			ctx.SetHook(backend.URL+"/hook", map[string]int{"id": 1})
+			ctx.JSON("ok")
+		})
+
+		Convey("生成并返回请求ID", func() {
+			w := serve(r, http.MethodGet, "/", "")
+			id := w.Header().Get(xhttp.RequestIDHeader)
+			So(id, ShouldNotBeEmpty)
+			So(w.Body.String(), ShouldContainSubstring, id)
+		})
+
+		Convey("沿用请求中的请求ID", func() {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(xhttp.RequestIDHeader, "abc-123")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			So(w.Header().Get(xhttp.RequestIDHeader), ShouldEqual, "abc-123")
+
+			req.Header.Set(xhttp.RequestIDHeader, "bad id\n")
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			So(w.Header().Get(xhttp.RequestIDHeader), ShouldNotEqual, "bad id\n")
+		})
+
+		Convey("转发给下游请求和回调", func() {
+			req := httptest.NewRequest(http.MethodGet, "/call", nil)
+			req.Header.Set(xhttp.RequestIDHeader, "abc-456")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			for i := 0; i < 3; i++ {
+				select {
+				case id := <-ids:
+					So(id, ShouldEqual, "abc-456")
+				case <-time.After(3 * time.Second):
+					So("请求超时", ShouldBeEmpty)
+				}
+			}
+		})
+	})
+}
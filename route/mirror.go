@@ -0,0 +1,177 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	log "github.com/HiData-xyz/hit/log"
+	"github.com/HiData-xyz/hit/pool"
+	"github.com/HiData-xyz/hit/trace"
+)
+
+// ShadowHeader 镜像请求携带的请求头, 影子服务可据此跳过副作用
+const ShadowHeader = "X-Hit-Shadow"
+
+// MirrorConfig 流量镜像配置
+type MirrorConfig struct {
+	Upstreams []string // 影子服务地址
+	Balancer  Balancer // 多个影子服务之间的负载均衡策略, 默认轮询
+
+	Percent float64       // 镜像的请求比例, 0-100
+	Timeout time.Duration // 镜像请求超时时间, 默认10秒
+	MaxBody int64         // 镜像和比较的最大 body, 请求 body 超过时不镜像, 响应 body 超过时只比较长度和摘要, 默认1M
+
+	OnResult func(res *MirrorResult) // 比较结果, 为空时只记录日志
+	Pool     *pool.Pool              // 执行镜像请求的协程池, 默认新建
+}
+
+// MirrorResult 主请求与镜像请求的比较结果
+type MirrorResult struct {
+	Method string
+	Path   string
+
+	Status       int // 主请求状态码
+	ShadowStatus int // 镜像请求状态码
+	StatusMatch  bool
+	BodyMatch    bool // body 超过 MaxBody 时比较长度和摘要
+
+	Body       []byte // 主请求响应, 超过 MaxBody 时为空
+	ShadowBody []byte // 镜像请求响应, 超过 MaxBody 时为空
+	Err        error  // 镜像请求失败的原因
+}
+
+// Match 状态码和 body 是否一致
+func (res *MirrorResult) Match() bool {
+	return res.Err == nil && res.StatusMatch && res.BodyMatch
+}
+
+// Mirror 将一定比例的请求异步复制到影子服务, 丢弃影子服务的响应, 只与主请求的响应比较
+// 镜像请求在独立的协程池中执行, 协程池繁忙时直接丢弃, 不影响主请求的耗时
+type Mirror struct {
+	cfg   MirrorConfig
+	proxy *Proxy
+	pool  *pool.Pool
+}
+
+// NewMirror 返回流量镜像中间件
+func NewMirror(cfg MirrorConfig) (*Mirror, error) {
+	p, err := NewProxy(ProxyConfig{Upstreams: cfg.Upstreams, Balancer: cfg.Balancer})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxBody <= 0 {
+		cfg.MaxBody = 1 << 20
+	}
+	m := &Mirror{cfg: cfg, proxy: p, pool: cfg.Pool}
+	if m.pool == nil {
+		m.pool = pool.NewPool(8, 256).SetName("mirror")
+	}
+	return m, nil
+}
+
+// Close 释放资源
+func (m *Mirror) Close() {
+	m.proxy.Close()
+	if m.cfg.Pool == nil {
+		m.pool.Close()
+	}
+}
+
+// Handle 中间件
+func (m *Mirror) Handle(ctx *Context) {
+	if rand.Float64()*100 >= m.cfg.Percent || ctx.r.ContentLength > m.cfg.MaxBody {
+		return
+	}
+
+	var body []byte
+	if ctx.r.Body != nil && ctx.r.Body != http.NoBody {
+		// ContentLength 可能未知, 最多读取 MaxBody+1 字节判断是否超过
+		b, err := ioutil.ReadAll(io.LimitReader(ctx.r.Body, m.cfg.MaxBody+1))
+		if err != nil {
+			ctx.Error(ErrBadRequest.WithErr(err))
+			return
+		}
+		if int64(len(b)) > m.cfg.MaxBody {
+			// 不镜像, 已读取的部分和剩余的 body 交给主请求
+			ctx.r.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(b), ctx.r.Body), Closer: ctx.r.Body}
+			return
+		}
+		ctx.r.Body.Close()
+		ctx.r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		body = b
+	}
+	c := log.WithRequestID(context.Background(), ctx.requestID)
+	if sc, ok := trace.SpanContextFromContext(ctx.r.Context()); ok {
+		c = trace.ContextWithRemote(c, sc)
+	}
+	shadow := ctx.r.Clone(c)
+
+	w := ctx.w
+	cw := newCaptureWriter(w, m.cfg.MaxBody)
+	ctx.w = cw
+	defer func() {
+		ctx.w = w
+	}()
+	ctx.Next()
+
+	err := m.pool.TryPush(func() {
+		m.shadow(shadow, body, cw)
+	})
+	if err != nil {
+		ctx.Logger().Debug("镜像请求已丢弃", log.String("path", shadow.URL.Path), log.ZapError(err))
+	}
+}
+
+// readCloser 读取 Reader, 关闭时关闭原始的 body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// shadow 发送镜像请求并比较响应
+func (m *Mirror) shadow(r *http.Request, body []byte, primary *captureWriter) {
+	c, cancel := context.WithTimeout(r.Context(), m.cfg.Timeout)
+	defer cancel()
+	r = r.WithContext(c)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.Header.Set(ShadowHeader, "1")
+
+	// 镜像响应只记录 MaxBody 以内的 body, 超过时只记录长度和摘要
+	sw := newCaptureWriter(&discardWriter{header: make(http.Header)}, m.cfg.MaxBody)
+	err := m.proxy.forward(NewContext(sw, r, nil))
+
+	res := &MirrorResult{
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		Status:       primary.Status(),
+		ShadowStatus: sw.status,
+		Body:         primary.body.Bytes(),
+		ShadowBody:   sw.body.Bytes(),
+		Err:          err,
+	}
+	res.StatusMatch = res.Status == res.ShadowStatus
+	res.BodyMatch = primary.sameBody(sw)
+
+	if m.cfg.OnResult != nil {
+		m.cfg.OnResult(res)
+		return
+	}
+	if !res.Match() {
+		log.Ctx(c).Info("镜像请求响应不一致",
+			log.String("method", res.Method),
+			log.String("path", res.Path),
+			log.Int("status", res.Status),
+			log.Int("shadow_status", res.ShadowStatus),
+			log.Bool("body_match", res.BodyMatch),
+			log.ZapError(res.Err),
+		)
+	}
+}
@@ -0,0 +1,372 @@
+package route
+
+import (
+	"context"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/HiData-xyz/hit/log"
+	"github.com/HiData-xyz/hit/trace"
+)
+
+// 转发请求相关错误
+var (
+	ErrBadGateway         = NewHTTPError(http.StatusBadGateway, http.StatusBadGateway, "上游服务异常")
+	ErrServiceUnavailable = NewHTTPError(http.StatusServiceUnavailable, http.StatusServiceUnavailable, "没有可用的上游服务")
+)
+
+// Upstream 上游服务
+type Upstream struct {
+	URL *url.URL
+
+	down  int32 // 健康检查失败时为 1
+	conns int64 // 正在转发的请求数量
+}
+
+// Healthy 是否健康
+func (u *Upstream) Healthy() bool {
+	return atomic.LoadInt32(&u.down) == 0
+}
+
+// Conns 正在转发的请求数量
+func (u *Upstream) Conns() int64 {
+	return atomic.LoadInt64(&u.conns)
+}
+
+// Balancer 负载均衡策略, 从上游服务中选择一个健康的服务, 没有可用服务时返回 nil
+type Balancer interface {
+	Pick(ups []*Upstream, r *http.Request) *Upstream
+}
+
+// RoundRobin 轮询
+func RoundRobin() Balancer {
+	return new(roundRobin)
+}
+
+type roundRobin struct {
+	n uint64
+}
+
+func (b *roundRobin) Pick(ups []*Upstream, r *http.Request) *Upstream {
+	for range ups {
+		u := ups[atomic.AddUint64(&b.n, 1)%uint64(len(ups))]
+		if u.Healthy() {
+			return u
+		}
+	}
+	return nil
+}
+
+// LeastConn 最少连接数
+func LeastConn() Balancer {
+	return leastConn{}
+}
+
+type leastConn struct{}
+
+func (leastConn) Pick(ups []*Upstream, r *http.Request) (u *Upstream) {
+	for _, val := range ups {
+		if !val.Healthy() {
+			continue
+		}
+		if u == nil || val.Conns() < u.Conns() {
+			u = val
+		}
+	}
+	return
+}
+
+// ConsistentHash 一致性哈希, 相同 key 的请求转发到同一个上游服务
+// key 为空时使用客户端IP
+func ConsistentHash(key func(r *http.Request) string) Balancer {
+	if key == nil {
+		key = clientIP
+	}
+	return &consistentHash{key: key}
+}
+
+// replicas 一致性哈希中每个上游服务的虚拟节点数量
+const replicas = 128
+
+type consistentHash struct {
+	key func(r *http.Request) string
+
+	once   sync.Once
+	hashes []uint32             // 排序后的虚拟节点
+	nodes  map[uint32]*Upstream // 虚拟节点对应的上游服务
+}
+
+func (b *consistentHash) init(ups []*Upstream) {
+	b.nodes = make(map[uint32]*Upstream, len(ups)*replicas)
+	for _, u := range ups {
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + u.URL.String()))
+			b.hashes = append(b.hashes, h)
+			b.nodes[h] = u
+		}
+	}
+	sort.Slice(b.hashes, func(i, j int) bool { return b.hashes[i] < b.hashes[j] })
+}
+
+func (b *consistentHash) Pick(ups []*Upstream, r *http.Request) *Upstream {
+	b.once.Do(func() { b.init(ups) })
+	if len(b.hashes) == 0 {
+		return nil
+	}
+
+	h := crc32.ChecksumIEEE([]byte(b.key(r)))
+	i := sort.Search(len(b.hashes), func(i int) bool { return b.hashes[i] >= h })
+	// 顺时针查找第一个健康的节点
+	for n := 0; n < len(b.hashes); n++ {
+		u := b.nodes[b.hashes[(i+n)%len(b.hashes)]]
+		if u.Healthy() {
+			return u
+		}
+	}
+	return nil
+}
+
+// clientIP 返回请求的客户端IP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// HealthCheck 主动健康检查配置
+type HealthCheck struct {
+	Path     string        // 检查路径, 返回 2xx 视为健康
+	Interval time.Duration // 检查间隔, 为 0 时不检查
+	Timeout  time.Duration // 单次检查超时时间
+}
+
+// ProxyConfig 反向代理配置
+type ProxyConfig struct {
+	Upstreams []string // 上游服务地址, 如 http://127.0.0.1:8080/base
+	Balancer  Balancer // 负载均衡策略, 默认轮询
+
+	Prefix      string              // 只转发该前缀的请求, 按路径段匹配, 作为全局中间件使用时其他请求继续执行方法链
+	StripPrefix bool                // 转发时去除 Prefix
+	Rewrite     func(string) string // 改写转发路径
+	Header      http.Header         // 转发时设置的请求头
+
+	HealthCheck HealthCheck
+
+	Transport     http.RoundTripper // 默认 http.DefaultTransport
+	FlushInterval time.Duration     // 响应刷新间隔, 为负数时每次写入后立即刷新
+}
+
+// Proxy 反向代理, 流式转发请求和响应, 在多个上游服务之间负载均衡
+type Proxy struct {
+	cfg       ProxyConfig
+	upstreams []*Upstream
+	proxy     *httputil.ReverseProxy
+
+	cancel context.CancelFunc
+}
+
+// upstreamKey 在请求的 context 中保存选中的上游服务
+type upstreamKey struct{}
+
+// proxyErrKey 在请求的 context 中保存转发错误
+type proxyErrKey struct{}
+
+// NewProxy 返回反向代理, 配置了健康检查时在后台运行健康检查
+func NewProxy(cfg ProxyConfig) (*Proxy, error) {
+	p := &Proxy{cfg: cfg}
+	for _, val := range cfg.Upstreams {
+		u, err := url.Parse(val)
+		if err != nil {
+			return nil, err
+		}
+		p.upstreams = append(p.upstreams, &Upstream{URL: u})
+	}
+	if p.cfg.Balancer == nil {
+		p.cfg.Balancer = RoundRobin()
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Director:      p.director,
+		Transport:     cfg.Transport,
+		FlushInterval: cfg.FlushInterval,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			*r.Context().Value(proxyErrKey{}).(*error) = err
+		},
+	}
+
+	var ctx context.Context
+	ctx, p.cancel = context.WithCancel(context.Background())
+	if cfg.HealthCheck.Interval > 0 {
+		p.check(ctx)
+		go p.runHealthCheck(ctx)
+	}
+	return p, nil
+}
+
+// Upstreams 返回全部上游服务
+func (p *Proxy) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// Close 停止健康检查
+func (p *Proxy) Close() {
+	p.cancel()
+}
+
+// Handle 转发请求, 可作为路由处理方法或全局中间件使用
+func (p *Proxy) Handle(ctx *Context) {
+	if p.cfg.Prefix != "" && !hasPathPrefix(ctx.r.URL.Path, p.cfg.Prefix) {
+		return
+	}
+	if err := p.forward(ctx); err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.Abort()
+}
+
+// forward 选择上游服务并转发请求
+func (p *Proxy) forward(ctx *Context) error {
+	u := p.cfg.Balancer.Pick(p.upstreams, ctx.r)
+	if u == nil {
+		return ErrServiceUnavailable
+	}
+	atomic.AddInt64(&u.conns, 1)
+	defer atomic.AddInt64(&u.conns, -1)
+
+	c, span := trace.Start(ctx.r.Context(), "proxy "+ctx.r.Method, trace.KindClient)
+	span.SetAttribute("upstream", u.URL.String())
+	defer span.End()
+
+	var err error
+	c = context.WithValue(c, upstreamKey{}, u)
+	c = context.WithValue(c, proxyErrKey{}, &err)
+	p.proxy.ServeHTTP(ctx.w, ctx.r.WithContext(c))
+	if err != nil {
+		span.SetError(err)
+		ctx.Logger().Error("转发请求失败", log.String("upstream", u.URL.String()), log.String("path", ctx.r.URL.Path), log.ZapError(err))
+		return ErrBadGateway.WithErr(err)
+	}
+	ctx.written = true
+	return nil
+}
+
+// director 改写转发请求的地址和请求头
+func (p *Proxy) director(r *http.Request) {
+	u := r.Context().Value(upstreamKey{}).(*Upstream)
+
+	path := r.URL.Path
+	if p.cfg.StripPrefix && hasPathPrefix(path, p.cfg.Prefix) {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(p.cfg.Prefix, "/"))
+	}
+	if p.cfg.Rewrite != nil {
+		path = p.cfg.Rewrite(path)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	r.Header.Set("X-Forwarded-Host", r.Host)
+	if r.TLS != nil {
+		r.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		r.Header.Set("X-Forwarded-Proto", "http")
+	}
+	for k, v := range p.cfg.Header {
+		r.Header[k] = v
+	}
+	if span := trace.SpanFromContext(r.Context()); span != nil {
+		trace.Inject(r.Header, span.Context())
+	}
+
+	r.URL.Scheme = u.URL.Scheme
+	r.URL.Host = u.URL.Host
+	r.URL.Path = strings.TrimSuffix(u.URL.Path, "/") + path
+	r.URL.RawPath = ""
+	r.Host = u.URL.Host
+	if u.URL.RawQuery != "" {
+		if r.URL.RawQuery == "" {
+			r.URL.RawQuery = u.URL.RawQuery
+		} else {
+			r.URL.RawQuery = u.URL.RawQuery + "&" + r.URL.RawQuery
+		}
+	}
+	// 与 httputil.NewSingleHostReverseProxy 一致, 避免默认 User-Agent
+	if _, ok := r.Header["User-Agent"]; !ok {
+		r.Header.Set("User-Agent", "")
+	}
+}
+
+// runHealthCheck 定时检查上游服务
+func (p *Proxy) runHealthCheck(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.HealthCheck.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.check(ctx)
+		}
+	}
+}
+
+// check 并发检查全部上游服务
+func (p *Proxy) check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams {
+		wg.Add(1)
+		go func(u *Upstream) {
+			defer wg.Done()
+			var down int32
+			if err := p.probe(ctx, u); err != nil {
+				down = 1
+			}
+			if atomic.SwapInt32(&u.down, down) != down {
+				log.Info("上游服务状态变化", log.String("upstream", u.URL.String()), log.Bool("healthy", down == 0))
+			}
+		}(u)
+	}
+	wg.Wait()
+}
+
+// probe 请求健康检查路径
+func (p *Proxy) probe(ctx context.Context, u *Upstream) error {
+	hc := p.cfg.HealthCheck
+	timeout := hc.Timeout
+	if timeout <= 0 {
+		timeout = hc.Interval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	target := *u.URL
+	target.Path = strings.TrimSuffix(target.Path, "/") + hc.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	transport := p.cfg.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return ErrBadGateway
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package route_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newBackend 返回在响应中标明自身名称和请求信息的上游服务
+func newBackend(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Backend", name)
+		fmt.Fprintf(w, "%s %s %s %s %s", name, r.Method, r.URL.Path, r.Header.Get("X-Forwarded-Proto"), b)
+	}))
+}
+
+func serve(r *route.Route, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestProxy(t *testing.T) {
+	Convey("测试反向代理", t, func() {
+		a, b := newBackend("a"), newBackend("b")
+		defer a.Close()
+		defer b.Close()
+
+		Convey("轮询转发, 改写路径和请求头", func() {
+			p, err := route.NewProxy(route.ProxyConfig{
+				Upstreams:   []string{a.URL, b.URL + "/v2"},
+				Prefix:      "/api",
+				StripPrefix: true,
+			})
+			So(err, ShouldBeNil)
+			defer p.Close()
+
+			r := route.New()
+			r.Use(p.Handle)
+			r.Get("/local", func(ctx *route.Context) { ctx.JSON("local") })
+			r.Get("/apix", func(ctx *route.Context) { ctx.JSON("apix") })
+
+			seen := map[string]bool{}
+			for i := 0; i < 4; i++ {
+				w := serve(r, http.MethodPut, "/api/user", "body")
+				So(w.Code, ShouldEqual, http.StatusOK)
+				seen[w.Body.String()] = true
+			}
+			So(seen, ShouldContainKey, "a PUT /user http body")
+			So(seen, ShouldContainKey, "b PUT /v2/user http body")
+
+			So(serve(r, http.MethodGet, "/local", "").Body.String(), ShouldEqual, `"local"`)
+			// 按路径段匹配前缀
+			So(serve(r, http.MethodGet, "/apix", "").Body.String(), ShouldEqual, `"apix"`)
+			So(serve(r, http.MethodGet, "/api", "").Header().Get("X-Backend"), ShouldNotBeEmpty)
+		})
+
+		Convey("最少连接数", func() {
+			p, _ := route.NewProxy(route.ProxyConfig{Upstreams: []string{a.URL, b.URL}, Balancer: route.LeastConn()})
+			defer p.Close()
+			u := route.LeastConn().Pick(p.Upstreams(), httptest.NewRequest(http.MethodGet, "/", nil))
+			So(u, ShouldEqual, p.Upstreams()[0])
+		})
+
+		Convey("一致性哈希", func() {
+			p, _ := route.NewProxy(route.ProxyConfig{
+				Upstreams: []string{a.URL, b.URL},
+				Balancer: route.ConsistentHash(func(r *http.Request) string {
+					return r.URL.Query().Get("user")
+				}),
+			})
+			defer p.Close()
+			r := route.New()
+			r.Use(p.Handle)
+
+			for _, user := range []string{"1", "2", "3"} {
+				first := serve(r, http.MethodGet, "/?user="+user, "").Header().Get("X-Backend")
+				for i := 0; i < 3; i++ {
+					So(serve(r, http.MethodGet, "/?user="+user, "").Header().Get("X-Backend"), ShouldEqual, first)
+				}
+			}
+		})
+
+		Convey("健康检查", func() {
+			var down int32
+			c := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.LoadInt32(&down) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte("c"))
+			}))
+			defer c.Close()
+
+			p, _ := route.NewProxy(route.ProxyConfig{
+				Upstreams:   []string{c.URL},
+				HealthCheck: route.HealthCheck{Path: "/health", Interval: 10 * time.Millisecond},
+			})
+			defer p.Close()
+			r := route.New()
+			r.Use(p.Handle)
+			So(serve(r, http.MethodGet, "/", "").Body.String(), ShouldEqual, "c")
+
+			atomic.StoreInt32(&down, 1)
+			time.Sleep(50 * time.Millisecond)
+			So(p.Upstreams()[0].Healthy(), ShouldBeFalse)
+			So(serve(r, http.MethodGet, "/", "").Code, ShouldEqual, http.StatusServiceUnavailable)
+		})
+
+		Convey("上游服务不可用", func() {
+			c := newBackend("c")
+			c.Close()
+			r := route.New()
+			r.Post("/order", route.E(func(ctx *route.Context) error {
+				return ctx.Forward(c.URL)
+			}))
+			So(serve(r, http.MethodPost, "/order", "").Code, ShouldEqual, http.StatusBadGateway)
+		})
+
+		Convey("Context.Forward", func() {
+			r := route.New()
+			r.Post("/order", route.E(func(ctx *route.Context) error {
+				return ctx.Forward(a.URL)
+			}))
+			w := serve(r, http.MethodPost, "/order", `{"id":1}`)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldEqual, `a POST /order http {"id":1}`)
+		})
+	})
+}
+
+func TestMirror(t *testing.T) {
+	Convey("测试流量镜像", t, func() {
+		var shadowed int32
+		shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&shadowed, 1)
+			if r.Header.Get(route.ShadowHeader) == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			if r.URL.Path == "/big" {
+				// 超过 MaxBody 的响应, body 为 diff 时长度相同内容不同
+				big := strings.Repeat("x", 100)
+				if string(b) == "diff" {
+					big = strings.Repeat("y", 100)
+				}
+				w.Write([]byte(`"` + big + `"`))
+				return
+			}
+			switch string(b) {
+			case "diff":
+				w.Write([]byte(`"other"`))
+				return
+			case "fail":
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(`"ok"`))
+		}))
+		defer shadow.Close()
+
+		results := make(chan *route.MirrorResult, 10)
+		bodies := make(chan string, 10)
+		newRoute := func(percent float64) (*route.Route, *route.Mirror) {
+			m, err := route.NewMirror(route.MirrorConfig{
+				Upstreams: []string{shadow.URL},
+				Percent:   percent,
+				MaxBody:   16,
+				OnResult:  func(res *route.MirrorResult) { results <- res },
+			})
+			So(err, ShouldBeNil)
+			r := route.New()
+			r.Use(m.Handle)
+			r.Post("/order", func(ctx *route.Context) {
+				b, _ := ctx.GetBodyBytes()
+				So(len(b), ShouldBeGreaterThan, 0)
+				bodies <- string(b)
+				ctx.JSON("ok")
+			})
+			r.Post("/big", func(ctx *route.Context) {
+				ctx.JSON(strings.Repeat("x", 100))
+			})
+			return r, m
+		}
+
+		Convey("响应一致", func() {
+			r, m := newRoute(100)
+			defer m.Close()
+			So(serve(r, http.MethodPost, "/order", "same").Body.String(), ShouldEqual, `"ok"`)
+			So(<-bodies, ShouldEqual, "same")
+			res := <-results
+			So(res.Match(), ShouldBeTrue)
+			So(res.ShadowStatus, ShouldEqual, http.StatusOK)
+			So(atomic.LoadInt32(&shadowed), ShouldEqual, 1)
+		})
+
+		Convey("响应不一致", func() {
+			r, m := newRoute(100)
+			defer m.Close()
+			So(serve(r, http.MethodPost, "/order", "diff").Body.String(), ShouldEqual, `"ok"`)
+			res := <-results
+			So(res.StatusMatch, ShouldBeTrue)
+			So(res.BodyMatch, ShouldBeFalse)
+			So(string(res.ShadowBody), ShouldEqual, `"other"`)
+			<-bodies
+
+			So(serve(r, http.MethodPost, "/order", "fail").Code, ShouldEqual, http.StatusOK)
+			res = <-results
+			So(res.Match(), ShouldBeFalse)
+			So(res.StatusMatch, ShouldBeFalse)
+			So(res.ShadowStatus, ShouldEqual, http.StatusInternalServerError)
+			<-bodies
+		})
+
+		Convey("响应超过 MaxBody 时比较长度和摘要", func() {
+			r, m := newRoute(100)
+			defer m.Close()
+			serve(r, http.MethodPost, "/big", "same")
+			res := <-results
+			So(res.Match(), ShouldBeTrue)
+			So(res.ShadowBody, ShouldBeEmpty)
+
+			serve(r, http.MethodPost, "/big", "diff")
+			res = <-results
+			So(res.StatusMatch, ShouldBeTrue)
+			So(res.BodyMatch, ShouldBeFalse)
+		})
+
+		Convey("body 超过 MaxBody 时不镜像", func() {
+			r, m := newRoute(100)
+			defer m.Close()
+			body := strings.Repeat("x", 100)
+			req := httptest.NewRequest(http.MethodPost, "/order", ioutil.NopCloser(strings.NewReader(body)))
+			// 长度未知的 body 也不超过 MaxBody 读取
+			req.ContentLength = -1
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(<-bodies, ShouldEqual, body)
+			time.Sleep(20 * time.Millisecond)
+			So(atomic.LoadInt32(&shadowed), ShouldEqual, 0)
+		})
+
+		Convey("比例为0时不镜像", func() {
+			r, m := newRoute(0)
+			defer m.Close()
+			for i := 0; i < 10; i++ {
+				So(serve(r, http.MethodPost, "/order", "same").Code, ShouldEqual, http.StatusOK)
+				<-bodies
+			}
+			time.Sleep(20 * time.Millisecond)
+			So(atomic.LoadInt32(&shadowed), ShouldEqual, 0)
+		})
+	})
+}
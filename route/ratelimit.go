@@ -0,0 +1,293 @@
+package route
+
+import (
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/HiData-xyz/hit/log"
+)
+
+// ErrTooManyRequests 请求过于频繁
+var ErrTooManyRequests = NewHTTPError(http.StatusTooManyRequests, http.StatusTooManyRequests, "请求过于频繁")
+
+// RateResult 单次限流判断的结果
+type RateResult struct {
+	Allowed    bool
+	Limit      int           // 窗口内允许的请求数
+	Remaining  int           // 剩余可用的请求数
+	Reset      time.Duration // 额度完全恢复的剩余时间
+	RetryAfter time.Duration // 被拒绝时需要等待的时间
+}
+
+// RateAlgorithm 限流算法
+type RateAlgorithm interface {
+	// Take 根据 key 的状态判断是否放行并返回新的状态, 状态不存在时 state 为 nil
+	Take(state interface{}, now time.Time) (interface{}, RateResult)
+	// TTL 状态空闲超过该时间后可以清理, 清理后额度完全恢复
+	TTL() time.Duration
+}
+
+// TokenBucket 令牌桶算法, 桶容量为 burst, 每 per 时间补充 rate 个令牌, 允许短时突发
+func TokenBucket(rate int, per time.Duration, burst int) RateAlgorithm {
+	if burst < 1 {
+		burst = rate
+	}
+	return &tokenBucket{rate: float64(rate) / float64(per), burst: burst}
+}
+
+type tokenBucket struct {
+	rate  float64 // 每纳秒补充的令牌数
+	burst int
+}
+
+type bucketState struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) Take(state interface{}, now time.Time) (interface{}, RateResult) {
+	s, ok := state.(*bucketState)
+	if !ok {
+		s = &bucketState{tokens: float64(b.burst), last: now}
+	}
+	if elapsed := now.Sub(s.last); elapsed > 0 {
+		s.tokens = math.Min(float64(b.burst), s.tokens+float64(elapsed)*b.rate)
+		s.last = now
+	}
+
+	res := RateResult{Limit: b.burst}
+	if s.tokens >= 1 {
+		s.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((1 - s.tokens) / b.rate))
+	}
+	res.Remaining = int(s.tokens)
+	res.Reset = time.Duration(math.Ceil((float64(b.burst) - s.tokens) / b.rate))
+	return s, res
+}
+
+func (b *tokenBucket) TTL() time.Duration {
+	return time.Duration(float64(b.burst) / b.rate)
+}
+
+// SlidingWindow 滑动窗口算法, 任意 window 时间内最多 limit 个请求
+// 使用当前窗口和上一个窗口的计数按时间加权估算, 不保存每个请求的时间
+func SlidingWindow(limit int, window time.Duration) RateAlgorithm {
+	return &slidingWindow{limit: limit, window: window}
+}
+
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+}
+
+type windowState struct {
+	start     time.Time // 当前窗口的开始时间
+	cur, prev int
+}
+
+func (sw *slidingWindow) Take(state interface{}, now time.Time) (interface{}, RateResult) {
+	start := now.Truncate(sw.window)
+	s, ok := state.(*windowState)
+	if !ok {
+		s = &windowState{start: start}
+	}
+	if !s.start.Equal(start) {
+		if start.Sub(s.start) == sw.window {
+			s.prev = s.cur
+		} else {
+			s.prev = 0
+		}
+		s.cur = 0
+		s.start = start
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(sw.window)
+	count := float64(s.prev)*weight + float64(s.cur)
+
+	res := RateResult{Limit: sw.limit, Reset: sw.window - elapsed}
+	if count+1 <= float64(sw.limit) {
+		s.cur++
+		count++
+		res.Allowed = true
+	} else if s.cur+1 > sw.limit || s.prev == 0 {
+		res.RetryAfter = sw.window - elapsed
+	} else {
+		// 上一个窗口的权重降低到可以再放行一个请求的时间
+		need := float64(sw.limit-1-s.cur) / float64(s.prev)
+		res.RetryAfter = time.Duration((1-need)*float64(sw.window)) - elapsed
+	}
+	if s.prev > 0 {
+		// 上一个窗口的请求在滑出窗口后额度才完全恢复
+		res.Reset = sw.window
+	}
+	res.Remaining = sw.limit - int(math.Ceil(count))
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	return s, res
+}
+
+func (sw *slidingWindow) TTL() time.Duration {
+	return 2 * sw.window
+}
+
+// RateLimitStore 限流状态的存储
+type RateLimitStore interface {
+	// Take 使用 alg 原子地更新 key 的状态并返回判断结果
+	Take(key string, alg RateAlgorithm, now time.Time) (RateResult, error)
+}
+
+// MemoryRateStore 分片的内存限流存储, 空闲超过算法 TTL 的 key 会被清理
+type MemoryRateStore struct {
+	shards []*rateShard
+}
+
+type rateShard struct {
+	m       sync.Mutex
+	entries map[string]*rateEntry
+	sweep   time.Time // 下次清理的时间
+}
+
+type rateEntry struct {
+	state   interface{}
+	expires time.Time
+}
+
+// NewMemoryRateStore 返回内存限流存储
+// shards: 分片数量, 减少并发请求的锁竞争, 默认 32
+func NewMemoryRateStore(shards int) *MemoryRateStore {
+	if shards <= 0 {
+		shards = 32
+	}
+	s := &MemoryRateStore{shards: make([]*rateShard, shards)}
+	for i := range s.shards {
+		s.shards[i] = &rateShard{entries: make(map[string]*rateEntry)}
+	}
+	return s
+}
+
+// Take 实现 RateLimitStore
+func (s *MemoryRateStore) Take(key string, alg RateAlgorithm, now time.Time) (RateResult, error) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	shard := s.shards[h.Sum32()%uint32(len(s.shards))]
+
+	ttl := alg.TTL()
+	shard.m.Lock()
+	defer shard.m.Unlock()
+	if now.After(shard.sweep) {
+		shard.purge(now)
+		shard.sweep = now.Add(ttl)
+	}
+
+	e, ok := shard.entries[key]
+	if !ok || now.After(e.expires) {
+		e = &rateEntry{}
+		shard.entries[key] = e
+	}
+	var res RateResult
+	e.state, res = alg.Take(e.state, now)
+	e.expires = now.Add(ttl)
+	return res, nil
+}
+
+// Len 返回保存的 key 数量
+func (s *MemoryRateStore) Len() int {
+	var n int
+	for _, shard := range s.shards {
+		shard.m.Lock()
+		n += len(shard.entries)
+		shard.m.Unlock()
+	}
+	return n
+}
+
+// purge 清理空闲的 key
+func (shard *rateShard) purge(now time.Time) {
+	for key, e := range shard.entries {
+		if now.After(e.expires) {
+			delete(shard.entries, key)
+		}
+	}
+}
+
+// RateKeyFunc 返回限流的 key, 返回空字符串时不限流
+type RateKeyFunc func(ctx *Context) string
+
+// KeyByIP 按客户端IP限流, 在 IPFilter 之后执行时使用解析代理请求头后的地址
+func KeyByIP(ctx *Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// KeyBySubject 按认证通过的调用方限流, 需要在认证中间件之后执行, 未认证时按客户端IP限流
+func KeyBySubject(ctx *Context) string {
+	if sub := ctx.Subject(); sub != "" {
+		return "sub:" + sub
+	}
+	return KeyByIP(ctx)
+}
+
+// KeyByAPIKey 按 APIKey 中间件认证通过的调用方限流, 需要在 APIKey 之后执行
+// 未认证或不是 API Key 认证时按客户端IP限流, 随机的 API Key 不会绕过限流
+func KeyByAPIKey(ctx *Context) string {
+	if p := ctx.Principal(); p != nil && p.Method == AuthAPIKey && p.ID != "" {
+		return "key:" + p.ID
+	}
+	return KeyByIP(ctx)
+}
+
+// RateLimitConfig 限流配置
+type RateLimitConfig struct {
+	Algorithm RateAlgorithm  // 限流算法, 如 TokenBucket、SlidingWindow, 必须设置
+	Key       RateKeyFunc    // 限流的 key, 默认 KeyByIP
+	Store     RateLimitStore // 限流状态的存储, 默认 NewMemoryRateStore(0)
+}
+
+// RateLimit 限流中间件, 可以用于 Route.Use 或 Group
+//
+// 返回 RateLimit-Limit、RateLimit-Remaining、RateLimit-Reset 响应头
+// 超出限制时返回 429 和 Retry-After, 存储异常时放行请求
+func RateLimit(cfg RateLimitConfig) Handler {
+	if cfg.Algorithm == nil {
+		panic("route: RateLimit 需要设置 Algorithm")
+	}
+	if cfg.Key == nil {
+		cfg.Key = KeyByIP
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryRateStore(0)
+	}
+
+	return func(ctx *Context) {
+		key := cfg.Key(ctx)
+		if key == "" {
+			return
+		}
+		res, err := cfg.Store.Take(key, cfg.Algorithm, time.Now())
+		if err != nil {
+			ctx.Logger().Error("限流存储异常", log.String("key", key), log.ZapError(err))
+			return
+		}
+
+		h := ctx.w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			ctx.Error(ErrTooManyRequests)
+		}
+	}
+}
+
+// ceilSeconds 向上取整的秒数
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
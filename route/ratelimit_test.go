@@ -0,0 +1,111 @@
+package route_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimit(t *testing.T) {
+	Convey("测试限流", t, func() {
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		Convey("令牌桶", func() {
+			store := route.NewMemoryRateStore(4)
+			alg := route.TokenBucket(1, time.Second, 3)
+			for i := 0; i < 3; i++ {
+				res, err := store.Take("a", alg, now)
+				So(err, ShouldBeNil)
+				So(res.Allowed, ShouldBeTrue)
+				So(res.Remaining, ShouldEqual, 2-i)
+			}
+			res, _ := store.Take("a", alg, now)
+			So(res.Allowed, ShouldBeFalse)
+			So(res.RetryAfter, ShouldEqual, time.Second)
+
+			res, _ = store.Take("b", alg, now)
+			So(res.Allowed, ShouldBeTrue)
+
+			res, _ = store.Take("a", alg, now.Add(time.Second))
+			So(res.Allowed, ShouldBeTrue)
+			res, _ = store.Take("a", alg, now.Add(time.Second))
+			So(res.Allowed, ShouldBeFalse)
+		})
+
+		Convey("滑动窗口", func() {
+			store := route.NewMemoryRateStore(4)
+			alg := route.SlidingWindow(4, time.Minute)
+			for i := 0; i < 4; i++ {
+				res, _ := store.Take("a", alg, now.Add(30*time.Second))
+				So(res.Allowed, ShouldBeTrue)
+			}
+			res, _ := store.Take("a", alg, now.Add(30*time.Second))
+			So(res.Allowed, ShouldBeFalse)
+			So(res.RetryAfter, ShouldEqual, 30*time.Second)
+
+			// 下一个窗口开始时上一个窗口的请求仍然计入
+			res, _ = store.Take("a", alg, now.Add(time.Minute))
+			So(res.Allowed, ShouldBeFalse)
+			res, _ = store.Take("a", alg, now.Add(time.Minute+15*time.Second))
+			So(res.Allowed, ShouldBeTrue)
+			res, _ = store.Take("a", alg, now.Add(time.Minute+15*time.Second))
+			So(res.Allowed, ShouldBeFalse)
+		})
+
+		Convey("清理空闲的 key", func() {
+			store := route.NewMemoryRateStore(1)
+			alg := route.SlidingWindow(1, time.Second)
+			store.Take("a", alg, now)
+			store.Take("b", alg, now)
+			So(store.Len(), ShouldEqual, 2)
+			store.Take("c", alg, now.Add(time.Minute))
+			So(store.Len(), ShouldEqual, 1)
+		})
+
+		Convey("中间件", func() {
+			r := route.New()
+			r.Use(route.RateLimit(route.RateLimitConfig{Algorithm: route.SlidingWindow(2, time.Hour)}))
+			r.Get("/", func(ctx *route.Context) { ctx.JSON("ok") })
+			keys := route.APIKeys(map[string]route.Principal{"k1": {ID: "a"}, "k2": {ID: "b"}})
+			g := r.Group("/api", route.APIKey(keys), route.RateLimit(route.RateLimitConfig{
+				Algorithm: route.TokenBucket(1, time.Hour, 1),
+				Key:       route.KeyByAPIKey,
+			}))
+			g.Get("/x", func(ctx *route.Context) { ctx.JSON("ok") })
+
+			do := func(path, addr, key string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.RemoteAddr = addr
+				if key != "" {
+					req.Header.Set(route.APIKeyHeader, key)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				return w
+			}
+
+			w := do("/", "10.0.0.1:1000", "")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("RateLimit-Limit"), ShouldEqual, "2")
+			So(w.Header().Get("RateLimit-Remaining"), ShouldEqual, "1")
+			So(w.Header().Get("RateLimit-Reset"), ShouldNotBeEmpty)
+			So(do("/", "10.0.0.1:1001", "").Code, ShouldEqual, http.StatusOK)
+			w = do("/", "10.0.0.1:1002", "")
+			So(w.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(w.Header().Get("Retry-After"), ShouldNotBeEmpty)
+			So(do("/", "10.0.0.2:1000", "").Code, ShouldEqual, http.StatusOK)
+
+			So(do("/api/x", "10.0.0.3:1000", "k1").Code, ShouldEqual, http.StatusOK)
+			So(do("/api/x", "10.0.0.4:1000", "k1").Code, ShouldEqual, http.StatusTooManyRequests)
+			So(do("/api/x", "10.0.0.4:1000", "k2").Code, ShouldEqual, http.StatusOK)
+			// 未认证的 API Key 在认证时拒绝, 不产生新的限流 key
+			So(do("/api/x", "10.0.0.5:1000", "random").Code, ShouldEqual, http.StatusUnauthorized)
+			So(func() { route.RateLimit(route.RateLimitConfig{}) }, ShouldPanic)
+		})
+	})
+}
@@ -0,0 +1,209 @@
+package route
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/HiData-xyz/hit/log"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Policy 访问策略, 定义角色拥有的权限
+//
+// JSON 或 YAML 格式, 权限支持通配: "admin:*" 匹配 "admin:read", "*" 匹配全部权限
+//
+//	roles:
+//	  admin: ["admin:*", "user:read"]
+//	  viewer: ["user:read"]
+type Policy struct {
+	Roles map[string][]string `json:"roles" yaml:"roles"`
+}
+
+// Authorizer 基于角色和权限的授权, 从 claims 中读取角色和权限
+// 令牌直接携带的权限(scope)无需在策略中定义, 角色的权限由策略定义
+type Authorizer struct {
+	RolesClaim  string // 角色声明, 字符串或字符串数组, 默认 roles
+	ScopesClaim string // 权限声明, 空格分隔的字符串或字符串数组, 默认 scope
+
+	m      sync.RWMutex
+	policy *Policy
+	path   string
+	mod    time.Time // 策略文件的修改时间
+}
+
+// NewAuthorizer 返回使用 policy 的授权器
+func NewAuthorizer(policy *Policy) *Authorizer {
+	if policy == nil {
+		policy = &Policy{}
+	}
+	return &Authorizer{
+		RolesClaim:  "roles",
+		ScopesClaim: "scope",
+		policy:      policy,
+	}
+}
+
+// LoadPolicy 从 JSON 或 YAML 文件加载策略, 按扩展名 .yaml、.yml 识别 YAML
+func LoadPolicy(path string) (*Authorizer, error) {
+	a := NewAuthorizer(nil)
+	a.path = path
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload 重新加载策略文件, 加载失败时保留原有策略
+func (a *Authorizer) Reload() error {
+	if a.path == "" {
+		return nil
+	}
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+
+	policy := new(Policy)
+	switch strings.ToLower(filepath.Ext(a.path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, policy)
+	default:
+		err = json.Unmarshal(data, policy)
+	}
+	if err != nil {
+		return err
+	}
+
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.policy = policy
+	a.mod = info.ModTime()
+	return nil
+}
+
+// Watch 每隔 interval 检查策略文件, 文件修改后重新加载, 直到 ctx 结束
+func (a *Authorizer) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(a.path)
+			if err != nil {
+				log.Error("读取策略文件失败", log.String("path", a.path), log.ZapError(err))
+				continue
+			}
+			a.m.RLock()
+			changed := !info.ModTime().Equal(a.mod)
+			a.m.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := a.Reload(); err != nil {
+				log.Error("重新加载策略文件失败", log.String("path", a.path), log.ZapError(err))
+				continue
+			}
+			log.Info("重新加载策略文件", log.String("path", a.path))
+		}
+	}
+}
+
+// Permissions 返回角色和直接授予的权限合并后的权限
+func (a *Authorizer) Permissions(roles, scopes []string) []string {
+	a.m.RLock()
+	defer a.m.RUnlock()
+	perms := append([]string(nil), scopes...)
+	for _, role := range roles {
+		perms = append(perms, a.policy.Roles[role]...)
+	}
+	return perms
+}
+
+// Allowed 权限 perms 是否包含 want
+func Allowed(perms []string, want string) bool {
+	for _, p := range perms {
+		if p == want || p == "*" {
+			return true
+		}
+		if strings.HasSuffix(p, ":*") && strings.HasPrefix(want, p[:len(p)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// claimStrings 读取 claims 中的字符串或字符串数组, 字符串按空格分隔
+func claimStrings(claims map[string]interface{}, name string) (res []string) {
+	switch val := claims[name].(type) {
+	case string:
+		res = strings.Fields(val)
+	case []interface{}:
+		for _, v := range val {
+			if s, ok := v.(string); ok {
+				res = append(res, s)
+			}
+		}
+	}
+	return
+}
+
+// rolesAndScopes 读取 claims 或调用方的角色和权限
+func (a *Authorizer) rolesAndScopes(ctx *Context) (roles, scopes []string, ok bool) {
+	if ctx.claims == nil {
+		if p := ctx.principal; p != nil {
+			return p.Roles, p.Scopes, true
+		}
+		return nil, nil, false
+	}
+	b, err := json.Marshal(ctx.claims)
+	if err != nil {
+		return nil, nil, false
+	}
+	var claims map[string]interface{}
+	if err = json.Unmarshal(b, &claims); err != nil {
+		return nil, nil, false
+	}
+	return claimStrings(claims, a.RolesClaim), claimStrings(claims, a.ScopesClaim), true
+}
+
+// defaultAuthorizer 路由未设置授权器时使用, 只校验令牌直接携带的权限
+var defaultAuthorizer = NewAuthorizer(nil)
+
+// Require 授权中间件, 需要在 JWT、BasicAuth、APIKey 等认证中间件之后执行, 拥有全部权限 perms 时才继续执行
+// 使用 Route.SetAuthorizer 设置的策略将角色转换成权限
+//
+//	g.Get("/admin", route.Require("admin:read"), h)
+func Require(perms ...string) Handler {
+	return func(ctx *Context) {
+		a := defaultAuthorizer
+		if ctx.Route != nil && ctx.Route.authorizer != nil {
+			a = ctx.Route.authorizer
+		}
+
+		roles, scopes, ok := a.rolesAndScopes(ctx)
+		if !ok {
+			ctx.Error(ErrUnauthorized)
+			return
+		}
+		granted := a.Permissions(roles, scopes)
+		for _, p := range perms {
+			if !Allowed(granted, p) {
+				ctx.Error(ErrForbidden.WithDetails(p))
+				return
+			}
+		}
+	}
+}
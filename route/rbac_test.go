@@ -0,0 +1,155 @@
+package route_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HiData-xyz/hit/route"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequire(t *testing.T) {
+	Convey("测试基于角色和权限的授权", t, func() {
+		dir := t.TempDir()
+		yamlPath := filepath.Join(dir, "policy.yaml")
+		So(ioutil.WriteFile(yamlPath, []byte("roles:\n  admin: [\"admin:*\"]\n  viewer: [\"user:read\"]\n"), 0644), ShouldBeNil)
+
+		ks := route.HMACKeySet("secret")
+		auth, err := route.LoadPolicy(yamlPath)
+		So(err, ShouldBeNil)
+
+		r := route.New()
+		r.SetAuthorizer(auth)
+		g := r.Group("/admin", route.JWT(route.TokenConfig{Keys: ks}, &jwt.MapClaims{}))
+		g.Get("/users", route.Require("admin:read"), func(ctx *route.Context) { ctx.JSON("ok") })
+		g.Get("/profile", route.Require("user:read"), func(ctx *route.Context) { ctx.JSON("ok") })
+
+		call := func(path string, claims jwt.MapClaims) int {
+			claims["exp"] = time.Now().Add(time.Minute).Unix()
+			token, err := ks.Sign(claims)
+			So(err, ShouldBeNil)
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		Convey("按角色授权", func() {
+			So(call("/admin/users", jwt.MapClaims{"roles": []string{"admin"}}), ShouldEqual, http.StatusOK)
+			So(call("/admin/users", jwt.MapClaims{"roles": "viewer"}), ShouldEqual, http.StatusForbidden)
+			So(call("/admin/profile", jwt.MapClaims{"roles": "viewer"}), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("令牌直接携带的权限", func() {
+			So(call("/admin/users", jwt.MapClaims{"scope": "user:read admin:read"}), ShouldEqual, http.StatusOK)
+			So(call("/admin/users", jwt.MapClaims{"scope": "user:read"}), ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("未校验令牌", func() {
+			r := route.New()
+			r.Get("/admin", route.Require("admin:read"))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("重新加载 JSON 策略", func() {
+			jsonPath := filepath.Join(dir, "policy.json")
+			So(ioutil.WriteFile(jsonPath, []byte(`{"roles":{"viewer":["user:read"]}}`), 0644), ShouldBeNil)
+			auth, err := route.LoadPolicy(jsonPath)
+			So(err, ShouldBeNil)
+			r.SetAuthorizer(auth)
+			So(call("/admin/users", jwt.MapClaims{"roles": "viewer"}), ShouldEqual, http.StatusForbidden)
+
+			So(ioutil.WriteFile(jsonPath, []byte(`{"roles":{"viewer":["*"]}}`), 0644), ShouldBeNil)
+			So(auth.Reload(), ShouldBeNil)
+			So(call("/admin/users", jwt.MapClaims{"roles": "viewer"}), ShouldEqual, http.StatusOK)
+
+			So(ioutil.WriteFile(jsonPath, []byte(`{invalid`), 0644), ShouldBeNil)
+			So(auth.Reload(), ShouldNotBeNil)
+			So(call("/admin/users", jwt.MapClaims{"roles": "viewer"}), ShouldEqual, http.StatusOK)
+		})
+	})
+}
+
+func TestAuth(t *testing.T) {
+	Convey("测试 Basic 和 API Key 认证", t, func() {
+		users := route.Credentials{
+			"alice": route.NewCredential(route.Principal{Roles: []string{"admin"}}, "p@ss"),
+		}
+		keys := route.APIKeys(map[string]route.Principal{
+			"k-123": {ID: "billing", Scopes: []string{"invoice:read"}},
+		})
+
+		r := route.New()
+		r.SetAuthorizer(route.NewAuthorizer(&route.Policy{Roles: map[string][]string{"admin": {"*"}}}))
+		r.Get("/basic", route.BasicAuth("hit", users), route.Require("admin:read"), func(ctx *route.Context) {
+			ctx.JSON(ctx.Principal().ID + "/" + ctx.Principal().Method)
+		})
+		r.Get("/key", route.APIKey(keys, route.FromHeader(route.APIKeyHeader), route.FromQuery("api_key")),
+			route.Require("invoice:read"), func(ctx *route.Context) {
+				ctx.JSON(ctx.Subject())
+			})
+		r.Get("/key/admin", route.APIKey(keys), route.Require("admin:read"))
+
+		do := func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		Convey("Basic 认证", func() {
+			req := httptest.NewRequest(http.MethodGet, "/basic", nil)
+			req.SetBasicAuth("alice", "p@ss")
+			w := do(req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldContainSubstring, "alice/basic")
+
+			req.SetBasicAuth("alice", "wrong")
+			w = do(req)
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			So(w.Header().Get("WWW-Authenticate"), ShouldEqual, `Basic realm="hit"`)
+
+			req.SetBasicAuth("bob", "p@ss")
+			So(do(req).Code, ShouldEqual, http.StatusUnauthorized)
+
+			So(do(httptest.NewRequest(http.MethodGet, "/basic", nil)).Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("API Key 认证", func() {
+			req := httptest.NewRequest(http.MethodGet, "/key", nil)
+			req.Header.Set(route.APIKeyHeader, "k-123")
+			w := do(req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldContainSubstring, "billing")
+
+			So(do(httptest.NewRequest(http.MethodGet, "/key?api_key=k-123", nil)).Code, ShouldEqual, http.StatusOK)
+			So(do(httptest.NewRequest(http.MethodGet, "/key?api_key=k-456", nil)).Code, ShouldEqual, http.StatusUnauthorized)
+			So(do(httptest.NewRequest(http.MethodGet, "/key", nil)).Code, ShouldEqual, http.StatusUnauthorized)
+
+			req = httptest.NewRequest(http.MethodGet, "/key/admin", nil)
+			req.Header.Set(route.APIKeyHeader, "k-123")
+			So(do(req).Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("只保存密钥摘要", func() {
+			for hash, c := range keys {
+				So(hash, ShouldNotContainSubstring, "k-123")
+				So(route.VerifySecret(c.Hash, "k-123"), ShouldBeTrue)
+			}
+			// 密码使用加盐的 bcrypt 摘要
+			c := users["alice"]
+			So(c.Hash, ShouldStartWith, "$2a$")
+			So(c.Hash, ShouldNotEqual, route.NewCredential(route.Principal{}, "p@ss").Hash)
+			So(route.VerifyPassword(c.Hash, "p@ss"), ShouldBeTrue)
+			So(route.VerifyPassword(c.Hash, "p@sS"), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,64 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	log "github.com/HiData-xyz/hit/log"
+)
+
+// RecoveryHandler 处理方法链中发生的 panic
+// 方法链在其他协程中执行时(如 Timeout), v 为携带原协程调用栈的 *PanicError
+type RecoveryHandler func(ctx *Context, v interface{})
+
+// PanicError 在其他协程中捕获的 panic, 保留发生 panic 的协程的调用栈
+type PanicError struct {
+	Value interface{} // panic 的值
+	Stack []byte      // 发生 panic 的协程的调用栈
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// DefaultRecovery 默认的 panic 处理器
+// 记录 panic 值和调用栈, 使用 RequestID 中间件时同时记录请求ID, 并按路由配置的错误格式返回 500
+func DefaultRecovery(ctx *Context, v interface{}) {
+	stack := debug.Stack()
+	if pe, ok := v.(*PanicError); ok {
+		v, stack = pe.Value, pe.Stack
+	}
+	err := fmt.Errorf("panic: %v", v)
+	ctx.Logger().Error("处理请求时发生panic",
+		log.Any("panic", v),
+		log.String("stack", string(stack)),
+		log.String("method", ctx.r.Method),
+		log.String("path", ctx.r.URL.Path),
+	)
+
+	defer ctx.Stop()
+	if ctx.err == nil {
+		ctx.err = err
+	}
+	if ctx.Written() {
+		return
+	}
+	ctx.WriteError(ErrInternal.WithErr(err))
+}
+
+// recover 捕获方法链中的 panic, 交由路由的 panic 处理器处理
+func (r *Route) recover(ctx *Context) {
+	if r.recovery == nil {
+		return
+	}
+	v := recover()
+	if v == nil {
+		return
+	}
+	// 保留 net/http 中断响应的语义
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	r.recovery(ctx, v)
+}
@@ -0,0 +1,233 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/HiData-xyz/hit/util"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// RefreshTokenHeader 返回和读取刷新令牌的请求头
+var RefreshTokenHeader = "X-Refresh-Token"
+
+// 令牌类型
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// 刷新令牌错误
+var (
+	ErrRefreshTokenReused = errors.New("refresh token is reused")
+	ErrNoRevocationStore  = errors.New("没有设置令牌吊销存储")
+)
+
+// ErrInvalidRefreshToken 刷新令牌无效
+var ErrInvalidRefreshToken = NewHTTPError(http.StatusUnauthorized, http.StatusUnauthorized, "刷新令牌无效")
+
+// TokenPair 访问令牌和刷新令牌
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // 访问令牌有效期, 单位秒
+}
+
+// TokenIssuer 签发短期的访问令牌和长期的刷新令牌
+// 每次刷新都会吊销旧的刷新令牌并签发新的令牌, 同一次登录签发的令牌属于同一个令牌族,
+// 已吊销的刷新令牌再次使用时视为被盗用, 吊销整个令牌族.
+type TokenIssuer struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience []string
+	Leeway   time.Duration
+
+	AccessTTL  time.Duration // 访问令牌有效期, 默认15分钟
+	RefreshTTL time.Duration // 刷新令牌有效期, 默认30天
+
+	Store RevocationStore // 已吊销令牌的存储, 必须设置
+}
+
+// Config 返回校验访问令牌的配置, 用于 JWT 中间件
+func (iss *TokenIssuer) Config() TokenConfig {
+	return TokenConfig{
+		Keys:       iss.Keys,
+		Issuer:     iss.Issuer,
+		Audience:   iss.Audience,
+		Leeway:     iss.Leeway,
+		Revocation: iss.Store,
+	}
+}
+
+func (iss *TokenIssuer) accessTTL() time.Duration {
+	if iss.AccessTTL > 0 {
+		return iss.AccessTTL
+	}
+	return 15 * time.Minute
+}
+
+func (iss *TokenIssuer) refreshTTL() time.Duration {
+	if iss.RefreshTTL > 0 {
+		return iss.RefreshTTL
+	}
+	return 30 * 24 * time.Hour
+}
+
+// Issue 登录时签发令牌, extra 为访问令牌携带的自定义声明, 刷新时原样保留
+func (iss *TokenIssuer) Issue(subject string, extra map[string]interface{}) (*TokenPair, error) {
+	return iss.issue(subject, extra, util.UUID())
+}
+
+func (iss *TokenIssuer) issue(subject string, extra map[string]interface{}, family string) (pair *TokenPair, err error) {
+	now := time.Now()
+	pair = &TokenPair{ExpiresIn: int64(iss.accessTTL() / time.Second)}
+	pair.AccessToken, err = iss.Keys.Sign(iss.claims(subject, extra, family, TokenTypeAccess, now, iss.accessTTL()))
+	if err != nil {
+		return nil, err
+	}
+	pair.RefreshToken, err = iss.Keys.Sign(iss.claims(subject, extra, family, TokenTypeRefresh, now, iss.refreshTTL()))
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (iss *TokenIssuer) claims(subject string, extra map[string]interface{}, family, typ string, now time.Time, ttl time.Duration) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	claims["sub"] = subject
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	claims["jti"] = util.UUID()
+	claims["fam"] = family
+	claims["typ"] = typ
+	if iss.Issuer != "" {
+		claims["iss"] = iss.Issuer
+	}
+	// 只有一个 aud 时使用字符串, 兼容 jwt.StandardClaims
+	switch len(iss.Audience) {
+	case 0:
+	case 1:
+		claims["aud"] = iss.Audience[0]
+	default:
+		claims["aud"] = iss.Audience
+	}
+	return claims
+}
+
+// parse 校验令牌并返回声明
+func (iss *TokenIssuer) parse(token string) (jwt.MapClaims, *registered, error) {
+	claims := jwt.MapClaims{}
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	if _, err := parser.ParseWithClaims(token, claims, iss.Keys.Keyfunc); err != nil {
+		return nil, nil, err
+	}
+	cfg := iss.Config()
+	rc, err := cfg.validate(token, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, rc, nil
+}
+
+// Refresh 使用刷新令牌签发新的令牌, 并吊销旧的刷新令牌
+// 刷新令牌被重复使用时吊销整个令牌族, 返回 ErrRefreshTokenReused
+func (iss *TokenIssuer) Refresh(refreshToken string) (*TokenPair, error) {
+	if iss.Store == nil {
+		return nil, ErrNoRevocationStore
+	}
+	claims, rc, err := iss.parse(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if rc.Type != TokenTypeRefresh || rc.ID == "" || rc.Family == "" || rc.ExpiresAt == nil {
+		return nil, ErrTokenType
+	}
+	cfg := iss.Config()
+	if err = cfg.checkRevoked(&registered{Family: rc.Family}); err != nil {
+		return nil, err
+	}
+
+	fresh, err := iss.Store.Revoke(rc.ID, time.Unix(*rc.ExpiresAt, 0))
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		if _, err = iss.Store.Revoke(familyKey(rc.Family), time.Now().Add(iss.refreshTTL())); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	subject, _ := claims["sub"].(string)
+	extra := make(map[string]interface{})
+	for k, v := range claims {
+		switch k {
+		case "sub", "iat", "exp", "nbf", "jti", "fam", "typ", "iss", "aud":
+		default:
+			extra[k] = v
+		}
+	}
+	return iss.issue(subject, extra, rc.Family)
+}
+
+// Revoke 退出登录, 吊销令牌所在的整个令牌族
+func (iss *TokenIssuer) Revoke(token string) error {
+	if iss.Store == nil {
+		return ErrNoRevocationStore
+	}
+	_, rc, err := iss.parse(token)
+	if err != nil {
+		return err
+	}
+	if rc.Family == "" {
+		return ErrTokenType
+	}
+	_, err = iss.Store.Revoke(familyKey(rc.Family), time.Now().Add(iss.refreshTTL()))
+	return err
+}
+
+// familyKey 令牌族在吊销存储中的 ID
+func familyKey(family string) string {
+	return "fam:" + family
+}
+
+// SetTokenPair 签发访问令牌和刷新令牌, 分别设置到 TokenHeader 和 RefreshTokenHeader 响应头
+func (ctx *Context) SetTokenPair(iss *TokenIssuer, subject string, extra map[string]interface{}) (*TokenPair, error) {
+	pair, err := iss.Issue(subject, extra)
+	if err != nil {
+		return nil, err
+	}
+	ctx.w.Header().Set(TokenHeader, pair.AccessToken)
+	ctx.w.Header().Set(RefreshTokenHeader, pair.RefreshToken)
+	return pair, nil
+}
+
+// RefreshToken 刷新令牌的处理方法
+// 从 RefreshTokenHeader 请求头或 JSON body 的 refresh_token 字段读取刷新令牌, 返回新的 TokenPair
+func RefreshToken(iss *TokenIssuer) Handler {
+	return E(func(ctx *Context) error {
+		token := ctx.r.Header.Get(RefreshTokenHeader)
+		if token == "" {
+			var body struct {
+				RefreshToken string `json:"refresh_token"`
+			}
+			if err := ctx.GetBody(&body); err != nil {
+				return ErrInvalidRefreshToken.WithErr(err)
+			}
+			token = body.RefreshToken
+		}
+
+		pair, err := iss.Refresh(token)
+		if err != nil {
+			return ErrInvalidRefreshToken.WithErr(err)
+		}
+		ctx.w.Header().Set(TokenHeader, pair.AccessToken)
+		ctx.w.Header().Set(RefreshTokenHeader, pair.RefreshToken)
+		return ctx.JSON(pair)
+	})
+}
@@ -0,0 +1,57 @@
+package route
+
+import (
+	xhttp "github.com/HiData-xyz/hit/http"
+	log "github.com/HiData-xyz/hit/log"
+	"github.com/HiData-xyz/hit/util"
+)
+
+// maxRequestIDLen 请求中携带的请求ID的最大长度, 超出或包含非可见字符时重新生成
+const maxRequestIDLen = 128
+
+// RequestID 请求ID中间件, 应作为第一个全局中间件使用
+//
+// 读取请求头 X-Request-ID, 没有时使用 util.UUID 生成, 并在响应头中返回
+// 之后通过 ctx.Logger 记录的日志带有 request_id 字段;
+// 通过 ctx.Client() 发送的请求, 使用 ctx.Context() 发送的 http.GetContext、http.PostContext、http.Do 请求,
+// ctx.SetHook、ctx.HTTPHook 设置的回调, 以及 Forward、Proxy 转发的请求都会携带该请求ID
+func RequestID(ctx *Context) {
+	id := ctx.r.Header.Get(xhttp.RequestIDHeader)
+	if !validRequestID(id) {
+		id = util.UUID()
+		ctx.r.Header.Set(xhttp.RequestIDHeader, id)
+	}
+	ctx.requestID = id
+	ctx.ctx = log.WithRequestID(ctx.ctx, id)
+	ctx.w.Header().Set(xhttp.RequestIDHeader, id)
+}
+
+// validRequestID 请求ID只能包含可见的 ASCII 字符
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID 返回请求ID, 未使用 RequestID 中间件时返回空字符串
+func (ctx *Context) RequestID() string {
+	return ctx.requestID
+}
+
+// Client 返回绑定当前请求的 http 客户端, 发送的请求携带请求ID和追踪上下文
+//
+//	err := ctx.Client().Post(url, req, &res)
+func (ctx *Context) Client() *xhttp.Client {
+	return xhttp.WithContext(ctx.ctx)
+}
+
+// Logger 返回带有请求ID的日志
+func (ctx *Context) Logger() log.Logger {
+	return log.Ctx(ctx.ctx)
+}
@@ -0,0 +1,200 @@
+package route
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/HiData-xyz/hit/log"
+)
+
+// RevocationStore 已吊销令牌的存储, 记录令牌的 jti 或令牌族 ID
+type RevocationStore interface {
+	// Revoke 吊销 id 直至 exp, 返回 false 表示 id 已被吊销
+	Revoke(id string, exp time.Time) (bool, error)
+	// Revoked 是否已吊销
+	Revoked(id string) (bool, error)
+}
+
+// MemoryRevocation 内存存储, 过期的记录自动清理
+type MemoryRevocation struct {
+	m     sync.Mutex
+	ids   map[string]time.Time
+	sweep time.Time // 下次清理过期记录的时间
+}
+
+// NewMemoryRevocation 返回内存存储
+func NewMemoryRevocation() *MemoryRevocation {
+	return &MemoryRevocation{ids: make(map[string]time.Time)}
+}
+
+// Revoke 实现 RevocationStore 接口
+func (s *MemoryRevocation) Revoke(id string, exp time.Time) (bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	now := time.Now()
+	s.purge(now)
+	if e, ok := s.ids[id]; ok && e.After(now) {
+		return false, nil
+	}
+	s.ids[id] = exp
+	return true, nil
+}
+
+// Revoked 实现 RevocationStore 接口
+func (s *MemoryRevocation) Revoked(id string) (bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	e, ok := s.ids[id]
+	return ok && e.After(time.Now()), nil
+}
+
+// purge 每分钟最多清理一次过期的记录, 返回是否执行了清理
+func (s *MemoryRevocation) purge(now time.Time) bool {
+	if now.Before(s.sweep) {
+		return false
+	}
+	s.sweep = now.Add(time.Minute)
+	for id, e := range s.ids {
+		if !e.After(now) {
+			delete(s.ids, id)
+		}
+	}
+	return true
+}
+
+// FileRevocation 文件存储, 每次吊销追加一行记录, 打开时加载未过期的记录并改写文件
+// 清理过期记录时, 文件中的记录超过未过期记录的两倍则改写文件
+type FileRevocation struct {
+	*MemoryRevocation
+
+	path    string
+	file    *os.File
+	records int // 文件中的记录数
+}
+
+// revocation 文件中的一行记录
+type revocation struct {
+	ID  string `json:"id"`
+	Exp int64  `json:"exp"`
+}
+
+// NewFileRevocation 打开或创建文件存储
+func NewFileRevocation(path string) (s *FileRevocation, err error) {
+	s = &FileRevocation{
+		MemoryRevocation: NewMemoryRevocation(),
+		path:             path,
+	}
+	if err = s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 加载未过期的记录, 改写文件去除过期记录
+func (s *FileRevocation) load() error {
+	now := time.Now()
+	f, err := os.Open(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec revocation
+			if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+				continue
+			}
+			if exp := time.Unix(rec.Exp, 0); exp.After(now) {
+				s.ids[rec.ID] = exp
+			}
+		}
+		f.Close()
+		if err = scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return s.rewrite()
+}
+
+// rewrite 写入未过期的记录到临时文件后替换, 需要持有锁
+func (s *FileRevocation) rewrite() error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for id, exp := range s.ids {
+		if err = enc.Encode(&revocation{ID: id, Exp: exp.Unix()}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.records = len(s.ids)
+	return nil
+}
+
+// Revoke 实现 RevocationStore 接口, 写入文件后返回
+func (s *FileRevocation) Revoke(id string, exp time.Time) (bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.file == nil {
+		return false, os.ErrClosed
+	}
+	now := time.Now()
+	if s.purge(now) && s.records > 2*len(s.ids) {
+		if err := s.rewrite(); err != nil {
+			log.Error("改写吊销记录文件失败", log.String("path", s.path), log.ZapError(err))
+		}
+	}
+	if e, ok := s.ids[id]; ok && e.After(now) {
+		return false, nil
+	}
+
+	b, err := json.Marshal(&revocation{ID: id, Exp: exp.Unix()})
+	if err != nil {
+		return false, err
+	}
+	if _, err = s.file.Write(append(b, '\n')); err != nil {
+		return false, err
+	}
+	if err = s.file.Sync(); err != nil {
+		return false, err
+	}
+	s.records++
+	s.ids[id] = exp
+	return true, nil
+}
+
+// Close 关闭文件
+func (s *FileRevocation) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -7,8 +7,11 @@ import (
 	"net/http/pprof"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/HiData-xyz/hit/hook"
 	log "github.com/HiData-xyz/hit/log"
+	"github.com/HiData-xyz/hit/trace"
 )
 
 // 常用错误
@@ -21,6 +24,18 @@ var (
 // Handler 注册函数
 type Handler func(ctx *Context)
 
+// HandlerE 返回错误的注册函数, 错误交由路由的统一错误处理器处理
+type HandlerE func(ctx *Context) error
+
+// E 将 HandlerE 转换成 Handler
+func E(h HandlerE) Handler {
+	return func(ctx *Context) {
+		if err := h(ctx); err != nil {
+			ctx.Error(err)
+		}
+	}
+}
+
 // Router 一个简易的HTTP路由
 type Router interface {
 	// 启动HTTP服务
@@ -30,8 +45,6 @@ type Router interface {
 	Get(path string, h ...Handler)
 	Group(path string, h ...Handler) *Group
 
-	Error(err error) //
-
 	ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
@@ -56,8 +69,17 @@ type Route struct {
 
 	wg sync.WaitGroup // 同步锁等待
 
-	err     error // 处理链方法执行过程中产生的错误信息
-	isPprof bool  // 是否开启性能监控
+	errHandler ErrorHandler // 统一错误处理器
+	errFormat  ErrorFormat  // 错误返回格式
+
+	recovery RecoveryHandler // panic 处理器, 为空时不捕获 panic
+
+	authorizer *Authorizer // Require 中间件使用的授权器
+
+	dispatcher *hook.Dispatcher // 回调投递器
+	stopHooks  func()           // 停止回调投递器并等待结束
+
+	isPprof bool // 是否开启性能监控
 }
 
 // AddServer 添加、运行子服务
@@ -100,40 +122,53 @@ func (r *Route) DeleteServer(addr string) {
 
 // ServeHTTP 实现 HTTP.Server 接口
 func (r *Route) ServeHTTP(w http.ResponseWriter, _r *http.Request) {
-	ctx := NewContext(w, _r, r)
-	ctx.Reset(w, _r)
-
-	// 执行中间件
-	for _, h := range r.middle {
-		h(ctx)
-		if ctx.IsStop() {
-			return
-		}
+	// 沿用上游服务的追踪上下文, 整个方法链作为一个 Span
+	c := _r.Context()
+	if sc, ok := trace.Extract(_r.Header); ok {
+		c = trace.ContextWithRemote(c, sc)
 	}
+	c, span := trace.Start(c, _r.Method+" "+_r.URL.Path, trace.KindServer)
+	sw := &statusWriter{ResponseWriter: w}
+
+	ctx := NewContext(sw, _r, r)
+	ctx.Reset(sw, _r.WithContext(c))
+	ctx.ctx = trace.ContextWithSpan(ctx.ctx, span)
 
-	handles := r.Match(_r.URL.Path, _r.Method)
+	// 表单参数在 GetString 等方法中按需解析, 转发请求时不会提前读取 body
+	// 方法链: 全局中间件 --> 分组中间件 --> 路由处理方法
+	handles, pattern := r.root.lookup(_r.URL.Path, _r.Method)
 	if len(handles) == 0 {
-		ctx.EJSON(404, "页面不存在")
-		return
+		handles = Handles{notFound}
+	} else {
+		ctx.pattern = pattern
 	}
 
-	// defer func() {
-	// 	if err := recover(); err != nil {
-	// 		log.Info(fmt.Sprintf("%+v", err))
-	// 		ctx.EJSON(http.StatusInternalServerError, err)
-	// 	}
-	// }()
-
 	defer ctx.Finish()
-	// 解析URL、表单参数
-	_r.ParseForm()
-	for _, h := range handles {
-		h(ctx)
-		if ctx.IsStop() {
-			return
-		}
+	defer observeRequest(ctx, sw, time.Now())
+	defer endSpan(ctx, span, sw)
+	defer r.recover(ctx)
+
+	ctx.handles = make(Handles, 0, len(r.middle)+len(handles))
+	ctx.handles = append(ctx.handles, r.middle...)
+	ctx.handles = append(ctx.handles, handles...)
+	ctx.Next()
+}
+
+// endSpan 记录响应状态和错误并结束 Span
+func endSpan(ctx *Context, span *trace.Span, sw *statusWriter) {
+	span.SetAttribute("http.method", ctx.r.Method)
+	span.SetAttribute("http.target", ctx.r.URL.RequestURI())
+	span.SetAttribute("http.status_code", sw.Status())
+	if ctx.requestID != "" {
+		span.SetAttribute(log.RequestIDKey, ctx.requestID)
 	}
+	span.SetError(ctx.err)
+	span.End()
+}
 
+// notFound 路由不存在
+func notFound(ctx *Context) {
+	ctx.Error(ErrNotFound)
 }
 
 // Run 启动 HTTP 服务
@@ -200,6 +235,71 @@ func (r *Route) Run(addr string) error {
 func (r *Route) Stop() {
 	r.cancel()
 	r.wg.Wait()
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.dispatcher != nil {
+		r.dispatcher.Close()
+	}
+}
+
+// SetOutbox 使用 dir 目录保存待投递的回调, 进程重启后继续投递未完成的回调
+// 需要在处理请求以及调用 SetHookSecrets、SetHookCallback 之前调用
+func (r *Route) SetOutbox(dir string) error {
+	o, err := hook.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.dispatcher != nil {
+		r.stopHooks()
+		r.dispatcher.Close()
+	}
+	r.dispatcher = r.runDispatcher(o)
+	return nil
+}
+
+// Dispatcher 返回回调投递器, 可用于查看待投递的回调、死信以及重新投递死信
+// 未设置 outbox 时, 回调只保存在内存中
+func (r *Route) Dispatcher() *hook.Dispatcher {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.dispatcher == nil {
+		o, _ := hook.Open("")
+		r.dispatcher = r.runDispatcher(o)
+	}
+	return r.dispatcher
+}
+
+// SetHookSecrets 设置回调签名密钥, 回调请求携带 hook.SignatureHeader 签名请求头
+// 轮换密钥期间可同时设置新旧密钥, 接收方使用 VerifySignature 中间件校验
+func (r *Route) SetHookSecrets(secrets ...string) {
+	r.Dispatcher().SetSecrets(secrets...)
+}
+
+// SetHookCallback 设置回调投递完成后的通知, 投递成功或重试耗尽时调用
+func (r *Route) SetHookCallback(cb hook.Callback) {
+	r.Dispatcher().OnComplete(cb)
+}
+
+// runDispatcher 在后台运行回调投递器, 随服务停止
+func (r *Route) runDispatcher(o *hook.Outbox) *hook.Dispatcher {
+	d := hook.NewDispatcher(o, nil)
+	ctx, cancel := context.WithCancel(r.ctx)
+	done := make(chan struct{})
+	r.stopHooks = func() {
+		cancel()
+		<-done
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(done)
+		d.Run(ctx)
+	}()
+	return d
 }
 
 // Post 注册 POST 请求路由
@@ -250,9 +350,24 @@ func (r *Route) path(method, path string, h Handler, third ...Handler) {
 
 }
 
-// Error 设置 error 信息
-func (r *Route) Error(err error) {
-	r.err = err
+// SetErrorHandler 设置统一错误处理器
+func (r *Route) SetErrorHandler(h ErrorHandler) {
+	r.errHandler = h
+}
+
+// SetRecovery 设置 panic 处理器, 默认开启, 设置为 nil 时关闭
+func (r *Route) SetRecovery(h RecoveryHandler) {
+	r.recovery = h
+}
+
+// SetAuthorizer 设置 Require 中间件使用的授权器
+func (r *Route) SetAuthorizer(a *Authorizer) {
+	r.authorizer = a
+}
+
+// SetErrorFormat 设置错误返回格式
+func (r *Route) SetErrorFormat(f ErrorFormat) {
+	r.errFormat = f
 }
 
 func (r *Route) find(method, path string) (h Handles) {
@@ -266,11 +381,13 @@ func (r *Route) find(method, path string) (h Handles) {
 // New 实例化一个 Router 对象
 func New() (r *Route) {
 	rou := &Route{
-		paths:    map[string]map[string]Handles{},
-		ctx:      context.Background(),
-		children: make(map[string]*Route),
-		isPprof:  true,
-		root:     newTree(),
+		paths:      map[string]map[string]Handles{},
+		ctx:        context.Background(),
+		children:   make(map[string]*Route),
+		isPprof:    true,
+		root:       newTree(),
+		errHandler: DefaultErrorHandler,
+		recovery:   DefaultRecovery,
 	}
 	svr := http.Server{}
 	svr.Handler = rou
@@ -1,6 +1,8 @@
 package route_test
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"github.com/HiData-xyz/hit/route"
 
@@ -116,3 +118,36 @@ func TestRoutePath(t *testing.T) {
 		})
 	})
 }
+
+func TestRouteRecovery(t *testing.T) {
+	Convey("测试panic恢复", t, func() {
+		r := route.New()
+		r.Get("/panic", func(ctx *route.Context) {
+			var m map[string]int
+			m["a"] = 1
+		})
+
+		Convey("默认开启, 返回500", func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+		})
+
+		Convey("中间件中的panic", func() {
+			r.Use(func(ctx *route.Context) {
+				panic("middle")
+			})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+
+		Convey("关闭后继续向上抛出", func() {
+			r.SetRecovery(nil)
+			So(func() {
+				r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+			}, ShouldPanic)
+		})
+	})
+}
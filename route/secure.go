@@ -0,0 +1,108 @@
+package route
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NoncePlaceholder ContentSecurityPolicy 中的占位符, 替换为每个请求生成的 nonce
+const NoncePlaceholder = "{nonce}"
+
+// SecureConfig 安全响应头配置, 为空的字段不设置对应的响应头
+type SecureConfig struct {
+	HSTSMaxAge            time.Duration // Strict-Transport-Security 的 max-age, 为 0 时不设置
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	ContentTypeOptions string // X-Content-Type-Options, 通常为 nosniff
+	FrameOptions       string // X-Frame-Options, DENY 或 SAMEORIGIN
+	ReferrerPolicy     string // Referrer-Policy
+
+	// ContentSecurityPolicy 内容安全策略, 包含 NoncePlaceholder 时每个请求生成新的 nonce,
+	// 通过 ctx.CSPNonce 获取, 用于页面中的 <script nonce="...">
+	ContentSecurityPolicy string
+	CSPReportOnly         bool // 使用 Content-Security-Policy-Report-Only, 只报告不拦截
+}
+
+// DefaultSecureConfig Secure 使用的配置, 脚本和样式只允许同源和带有 nonce 的内联代码
+var DefaultSecureConfig = SecureConfig{
+	HSTSMaxAge:            365 * 24 * time.Hour,
+	HSTSIncludeSubdomains: true,
+	ContentTypeOptions:    "nosniff",
+	FrameOptions:          "DENY",
+	ReferrerPolicy:        "strict-origin-when-cross-origin",
+	ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self' 'nonce-{nonce}'; " +
+		"object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+}
+
+var defaultSecure = NewSecure(DefaultSecureConfig)
+
+// Secure 设置安全响应头, 使用 DefaultSecureConfig, 需要调整时复制后修改并使用 NewSecure
+func Secure(ctx *Context) {
+	defaultSecure(ctx)
+}
+
+// NewSecure 安全响应头中间件
+//
+//	cfg := route.DefaultSecureConfig
+//	cfg.FrameOptions = "SAMEORIGIN"
+//	r.Use(route.NewSecure(cfg))
+func NewSecure(cfg SecureConfig) Handler {
+	var hsts string
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge/time.Second), 10)
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if cfg.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	cspHeader := "Content-Security-Policy"
+	if cfg.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	withNonce := strings.Contains(cfg.ContentSecurityPolicy, NoncePlaceholder)
+
+	return func(ctx *Context) {
+		h := ctx.w.Header()
+		if hsts != "" {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+		if cfg.ContentTypeOptions != "" {
+			h.Set("X-Content-Type-Options", cfg.ContentTypeOptions)
+		}
+		if cfg.FrameOptions != "" {
+			h.Set("X-Frame-Options", cfg.FrameOptions)
+		}
+		if cfg.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		if cfg.ContentSecurityPolicy == "" {
+			return
+		}
+		csp := cfg.ContentSecurityPolicy
+		if withNonce {
+			ctx.cspNonce = randomToken(16)
+			csp = strings.ReplaceAll(csp, NoncePlaceholder, ctx.cspNonce)
+		}
+		h.Set(cspHeader, csp)
+	}
+}
+
+// CSPNonce 返回当前请求的 CSP nonce, 未使用 Secure 或策略中没有 NoncePlaceholder 时返回空字符串
+func (ctx *Context) CSPNonce() string {
+	return ctx.cspNonce
+}
+
+// randomToken 返回 n 字节随机数的 base64 编码, 可以用于 URL 和 cookie
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,148 @@
+package route_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSecure(t *testing.T) {
+	Convey("测试安全响应头", t, func() {
+		r := route.New()
+		r.Use(route.Secure)
+		r.Get("/page", func(ctx *route.Context) {
+			ctx.JSON(ctx.CSPNonce())
+		})
+
+		var nonces []string
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+			h := w.Header()
+			So(h.Get("Strict-Transport-Security"), ShouldEqual, "max-age=31536000; includeSubDomains")
+			So(h.Get("X-Content-Type-Options"), ShouldEqual, "nosniff")
+			So(h.Get("X-Frame-Options"), ShouldEqual, "DENY")
+			So(h.Get("Referrer-Policy"), ShouldEqual, "strict-origin-when-cross-origin")
+
+			nonce := strings.Trim(w.Body.String(), `"`)
+			So(nonce, ShouldNotBeEmpty)
+			So(h.Get("Content-Security-Policy"), ShouldContainSubstring, "script-src 'self' 'nonce-"+nonce+"'")
+			nonces = append(nonces, nonce)
+		}
+		So(nonces[0], ShouldNotEqual, nonces[1])
+
+		Convey("自定义配置", func() {
+			cfg := route.DefaultSecureConfig
+			cfg.HSTSMaxAge = 0
+			cfg.FrameOptions = "SAMEORIGIN"
+			cfg.ContentSecurityPolicy = "default-src 'self'"
+			cfg.CSPReportOnly = true
+			r := route.New()
+			r.Use(route.NewSecure(cfg))
+			r.Get("/page", func(ctx *route.Context) {
+				ctx.JSON(ctx.CSPNonce())
+			})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+			So(w.Header().Get("Strict-Transport-Security"), ShouldBeEmpty)
+			So(w.Header().Get("X-Frame-Options"), ShouldEqual, "SAMEORIGIN")
+			So(w.Header().Get("Content-Security-Policy"), ShouldBeEmpty)
+			So(w.Header().Get("Content-Security-Policy-Report-Only"), ShouldEqual, "default-src 'self'")
+			So(w.Body.String(), ShouldEqual, `""`)
+		})
+	})
+}
+
+func TestCSRF(t *testing.T) {
+	Convey("测试双重提交 cookie", t, func() {
+		r := route.New()
+		r.Use(route.CSRF(route.CSRFConfig{ExemptPaths: []string{"/webhook"}}))
+		ok := func(ctx *route.Context) { ctx.JSON(ctx.CSRFToken()) }
+		r.Get("/form", ok)
+		r.Post("/orders", ok)
+		keys := route.APIKeys(map[string]route.Principal{"k-1": {ID: "billing"}})
+		api := route.New()
+		api.Post("/orders", route.APIKey(keys), route.CSRF(route.CSRFConfig{}), ok)
+		r.Post("/webhook/pay", ok)
+		r.Post("/webhookx", ok)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+		cookies := w.Result().Cookies()
+		So(cookies, ShouldHaveLength, 1)
+		token := cookies[0].Value
+		So(w.Header().Get("X-CSRF-Token"), ShouldEqual, token)
+
+		post := func(body string, header ...string) int {
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+			req.AddCookie(&http.Cookie{Name: "csrf_token", Value: token})
+			for i := 0; i+1 < len(header); i += 2 {
+				req.Header.Set(header[i], header[i+1])
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w.Code
+		}
+		So(post(""), ShouldEqual, http.StatusForbidden)
+		So(post("", "X-CSRF-Token", "other"), ShouldEqual, http.StatusForbidden)
+		So(post("", "X-CSRF-Token", token), ShouldEqual, http.StatusOK)
+		So(post(url.Values{"csrf_token": {token}}.Encode(), "Content-Type", "application/x-www-form-urlencoded"), ShouldEqual, http.StatusOK)
+		// 只携带请求头而未认证的请求不豁免
+		So(post("", "Authorization", "Bearer xxx"), ShouldEqual, http.StatusForbidden)
+		So(post("", "X-API-Key", "xxx"), ShouldEqual, http.StatusForbidden)
+		// 浏览器会自动携带 Basic 认证, 不豁免
+		So(post("", "Authorization", "Basic dXNlcjpwYXNz"), ShouldEqual, http.StatusForbidden)
+
+		// APIKey 认证通过的请求豁免
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set(route.APIKeyHeader, "k-1")
+		w = httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook/pay", nil))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhookx", nil))
+		So(w.Code, ShouldEqual, http.StatusForbidden)
+	})
+
+	Convey("测试同步令牌", t, func() {
+		r := route.New()
+		r.Use(route.CSRF(route.CSRFConfig{Mode: route.CSRFSynchronizer, Secret: []byte("secret"), SessionCookie: "sid"}))
+		ok := func(ctx *route.Context) { ctx.JSON(ctx.CSRFToken()) }
+		r.Get("/form", ok)
+		r.Post("/orders", ok)
+
+		do := func(method, path, sid, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			if sid != "" {
+				req.AddCookie(&http.Cookie{Name: "sid", Value: sid})
+			}
+			if token != "" {
+				req.Header.Set("X-CSRF-Token", token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := do(http.MethodGet, "/form", "s1", "")
+		So(w.Result().Cookies(), ShouldBeEmpty)
+		token := w.Header().Get("X-CSRF-Token")
+		So(token, ShouldNotBeEmpty)
+		So(do(http.MethodGet, "/form", "s2", "").Header().Get("X-CSRF-Token"), ShouldNotEqual, token)
+
+		So(do(http.MethodPost, "/orders", "s1", token).Code, ShouldEqual, http.StatusOK)
+		So(do(http.MethodPost, "/orders", "s2", token).Code, ShouldEqual, http.StatusForbidden)
+		So(do(http.MethodPost, "/orders", "", token).Code, ShouldEqual, http.StatusForbidden)
+		So(func() { route.CSRF(route.CSRFConfig{Mode: route.CSRFSynchronizer}) }, ShouldPanic)
+	})
+}
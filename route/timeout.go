@@ -0,0 +1,219 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/HiData-xyz/hit/hook"
+	"github.com/HiData-xyz/hit/log"
+	"github.com/HiData-xyz/hit/metrics"
+)
+
+// 超时错误
+var (
+	ErrRequestTimeout = NewHTTPError(http.StatusServiceUnavailable, http.StatusServiceUnavailable, "请求处理超时")
+	ErrGatewayTimeout = NewHTTPError(http.StatusGatewayTimeout, http.StatusGatewayTimeout, "上游服务超时")
+)
+
+// requestTimeouts 按路由统计的超时请求数
+var requestTimeouts = metrics.NewCounter("hit_http_request_timeouts_total", "按路由统计的处理超时的请求数", "method", "route")
+
+// TimeoutConfig 超时配置
+type TimeoutConfig struct {
+	Timeout time.Duration // 处理超时时间
+	// Error 超时时返回的错误, 按路由配置的错误格式返回, 默认 ErrRequestTimeout(503),
+	// 网关类接口可以使用 ErrGatewayTimeout(504) 或自定义错误
+	Error *HTTPError
+}
+
+// Timeout 超时中间件, 可以用于 Route.Use 或 Group
+//
+// 剩余的方法链在新的协程中执行, 超时后取消请求的 context 并返回 cfg.Error;
+// 响应在方法链执行完成后写入, 超时前调用 Flush 的流式响应已经开始写入, 超时后只中断连接;
+// 超时后方法链中的写入被丢弃, 对 Context 的修改不再生效
+func Timeout(cfg TimeoutConfig) Handler {
+	if cfg.Error == nil {
+		cfg.Error = ErrRequestTimeout
+	}
+	return func(ctx *Context) {
+		if cfg.Timeout <= 0 {
+			return
+		}
+		deadline := time.Now().Add(cfg.Timeout)
+		c, cancel := context.WithDeadline(ctx.r.Context(), deadline)
+		defer cancel()
+		subCtx, subCancel := context.WithDeadline(ctx.ctx, deadline)
+		defer subCancel()
+
+		// 方法链使用 Context 的副本执行, 超时后与当前请求不再共享状态
+		tw := &timeoutWriter{w: ctx.w, header: ctx.w.Header().Clone()}
+		sub := *ctx
+		sub.w = tw
+		// 请求的 Header、Form 等与当前请求不共享, 超时后方法链的修改不影响当前请求
+		sub.r = ctx.r.Clone(c)
+		sub.ctx = subCtx
+		sub.hooks = append([]*hook.Hook(nil), ctx.hooks...)
+		// val 在协程启动前复制, 超时后方法链的 SetValue 不影响当前请求
+		sub.val = make(map[string]interface{}, len(ctx.val))
+		for k, v := range ctx.val {
+			sub.val[k] = v
+		}
+
+		done := make(chan struct{})
+		panics := make(chan *PanicError, 1)
+		go func() {
+			defer func() {
+				if v := recover(); v != nil {
+					// 在当前协程记录调用栈, 交由路由的 panic 处理器处理
+					panics <- &PanicError{Value: v, Stack: debug.Stack()}
+				}
+			}()
+			sub.Next()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			w, r, c, val := ctx.w, ctx.r, ctx.ctx, ctx.val
+			*ctx = sub
+			ctx.w, ctx.r, ctx.ctx, ctx.val = w, r, c, val
+			for k, v := range sub.val {
+				ctx.val[k] = v
+			}
+			tw.flush()
+		case pe := <-panics:
+			tw.timeout()
+			if pe.Value == http.ErrAbortHandler {
+				panic(pe.Value)
+			}
+			panic(pe)
+		case <-c.Done():
+			committed := tw.timeout()
+			sub.Stop()
+			if c.Err() != context.DeadlineExceeded {
+				// 客户端断开连接
+				ctx.Abort()
+				return
+			}
+			requestTimeouts.Inc(ctx.methodLabel(), ctx.routeLabel())
+			ctx.Logger().Error("请求处理超时",
+				log.String("method", ctx.r.Method),
+				log.String("path", ctx.r.URL.Path),
+				log.Duration("timeout", cfg.Timeout),
+			)
+			if committed {
+				// 响应已开始写入, 无法返回错误
+				ctx.err = cfg.Error
+				ctx.Abort()
+				return
+			}
+			ctx.Error(cfg.Error)
+		}
+	}
+}
+
+// timeoutWriter 缓存方法链的响应, 超时后丢弃之后的写入
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	m         sync.Mutex
+	status    int
+	body      bytes.Buffer
+	committed bool // 是否已写入 w
+	timedOut  bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.m.Lock()
+	defer tw.m.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = code
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.m.Lock()
+	defer tw.m.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	if tw.committed {
+		return tw.w.Write(b)
+	}
+	return tw.body.Write(b)
+}
+
+// Flush 实现 http.Flusher 接口, 写入缓存的响应, 之后的写入直接写入响应
+func (tw *timeoutWriter) Flush() {
+	tw.m.Lock()
+	defer tw.m.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.commit()
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// flush 方法链执行完成后写入响应
+func (tw *timeoutWriter) flush() {
+	tw.m.Lock()
+	defer tw.m.Unlock()
+	if tw.status == 0 && tw.body.Len() == 0 {
+		// 没有写入响应, 保留响应头由后续处理
+		if !tw.committed {
+			copyHeader(tw.w.Header(), tw.header)
+		}
+		return
+	}
+	tw.commit()
+}
+
+// commit 写入响应头和缓存的 body, 需要持有锁
+func (tw *timeoutWriter) commit() {
+	if tw.committed {
+		return
+	}
+	tw.committed = true
+	copyHeader(tw.w.Header(), tw.header)
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	tw.w.WriteHeader(tw.status)
+	tw.w.Write(tw.body.Bytes())
+	tw.body.Reset()
+}
+
+// timeout 标记超时, 返回响应是否已开始写入
+func (tw *timeoutWriter) timeout() bool {
+	tw.m.Lock()
+	defer tw.m.Unlock()
+	tw.timedOut = true
+	return tw.committed
+}
+
+// copyHeader 使用 src 替换 dst 中的响应头
+func copyHeader(dst, src http.Header) {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, vs := range src {
+		dst[k] = vs
+	}
+}
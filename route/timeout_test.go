@@ -0,0 +1,107 @@
+package route_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/HiData-xyz/hit/metrics"
+	"github.com/HiData-xyz/hit/route"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTimeout(t *testing.T) {
+	Convey("测试超时", t, func() {
+		late := make(chan error, 1)
+		r := route.New()
+		values := make(chan interface{}, 4)
+		r.Use(func(ctx *route.Context) {
+			ctx.GetResponseWriter().Header().Set("X-Before", "1")
+			ctx.SetValue("before", 1)
+			ctx.Next()
+			// 超时后方法链仍在执行时读取 val
+			for i := 0; i < 100; i++ {
+				ctx.GetValue("late")
+			}
+			values <- ctx.GetValue("handler")
+		})
+		g := r.Group("/api", route.Timeout(route.TimeoutConfig{Timeout: 50 * time.Millisecond}))
+		g.Get("/fast", func(ctx *route.Context) {
+			ctx.SetValue("handler", ctx.GetValue("before"))
+			ctx.GetResponseWriter().Header().Set("X-Handler", "1")
+			ctx.JSON("ok")
+		})
+		g.Get("/slow", func(ctx *route.Context) {
+			<-ctx.GetRequest().Context().Done()
+			<-ctx.Context().Done()
+			time.Sleep(10 * time.Millisecond)
+			// 超时后写入的值不影响当前请求
+			for i := 0; i < 100; i++ {
+				ctx.SetValue("late", i)
+			}
+			_, err := ctx.GetResponseWriter().Write([]byte("late"))
+			late <- err
+		})
+		g.Get("/error", func(ctx *route.Context) {
+			ctx.Error(route.ErrForbidden)
+		})
+		g.Get("/panic", func(ctx *route.Context) {
+			panicInHandler()
+		})
+		r.Get("/gateway", route.Timeout(route.TimeoutConfig{Timeout: 10 * time.Millisecond, Error: route.ErrGatewayTimeout}),
+			func(ctx *route.Context) {
+				time.Sleep(50 * time.Millisecond)
+			})
+
+		do := func(path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			return w
+		}
+
+		w := do("/api/fast")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldEqual, `"ok"`)
+		So(w.Header().Get("X-Before"), ShouldEqual, "1")
+		So(w.Header().Get("X-Handler"), ShouldEqual, "1")
+		So(<-values, ShouldEqual, 1)
+
+		So(do("/api/error").Code, ShouldEqual, http.StatusForbidden)
+		<-values
+
+		start := time.Now()
+		w = do("/api/slow")
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+		So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+		So(w.Body.String(), ShouldContainSubstring, "请求处理超时")
+		So(w.Header().Get("X-Before"), ShouldEqual, "1")
+		So(<-late, ShouldEqual, http.ErrHandlerTimeout)
+		So(w.Body.String(), ShouldNotContainSubstring, "late")
+		So(<-values, ShouldBeNil)
+
+		So(do("/gateway").Code, ShouldEqual, http.StatusGatewayTimeout)
+		<-values
+
+		// panic 的调用栈来自执行方法链的协程
+		var recovered interface{}
+		r.SetRecovery(func(ctx *route.Context, v interface{}) {
+			recovered = v
+			route.DefaultRecovery(ctx, v)
+		})
+		So(do("/api/panic").Code, ShouldEqual, http.StatusInternalServerError)
+		pe, ok := recovered.(*route.PanicError)
+		So(ok, ShouldBeTrue)
+		So(pe.Value, ShouldEqual, "boom")
+		So(string(pe.Stack), ShouldContainSubstring, "panicInHandler")
+
+		mw := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(mw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		So(mw.Body.String(), ShouldContainSubstring, `hit_http_request_timeouts_total{method="GET",route="/api/slow"}`)
+	})
+}
+
+func panicInHandler() {
+	panic("boom")
+}
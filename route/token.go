@@ -0,0 +1,278 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// 令牌校验错误
+var (
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+	ErrTokenUsedBefore  = errors.New("token used before issued")
+	ErrTokenIssuer      = errors.New("token issuer is invalid")
+	ErrTokenAudience    = errors.New("token audience is invalid")
+	ErrTokenRevoked     = errors.New("token is revoked")
+	ErrTokenType        = errors.New("token type is invalid")
+)
+
+// 令牌校验失败的HTTP错误, 错误原因在 Details 中返回
+var (
+	ErrTokenRequired = NewHTTPError(http.StatusUnauthorized, http.StatusUnauthorized, "缺少令牌")
+	ErrTokenInvalid  = NewHTTPError(http.StatusUnauthorized, http.StatusUnauthorized, "令牌无效")
+)
+
+// TokenExtractor 从请求中提取令牌, 没有令牌时返回空字符串
+type TokenExtractor func(r *http.Request) string
+
+// FromBearer 从请求头中提取 "Bearer <token>" 格式的令牌
+func FromBearer(header string) TokenExtractor {
+	return func(r *http.Request) string {
+		val := r.Header.Get(header)
+		if len(val) > 7 && strings.EqualFold(val[:7], "Bearer ") {
+			return strings.TrimSpace(val[7:])
+		}
+		return ""
+	}
+}
+
+// FromHeader 从请求头中提取原始的令牌
+func FromHeader(header string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.Header.Get(header)
+	}
+}
+
+// FromCookie 从 cookie 中提取令牌
+func FromCookie(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
+
+// FromQuery 从URL参数中提取令牌
+func FromQuery(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+// TokenConfig 令牌校验配置
+type TokenConfig struct {
+	Header   string        // 读取令牌的请求头, 默认 TokenHeader
+	Keys     *KeySet       // 验证签名的密钥集合
+	Issuer   string        // 期望的 iss, 为空时不校验
+	Audience []string      // 期望的 aud, 任一匹配即可, 为空时不校验
+	Leeway   time.Duration // 校验 exp、nbf、iat 时允许的时钟误差
+
+	Revocation RevocationStore // 已吊销令牌的存储, 为空时不检查
+
+	// Extractors 按顺序尝试提取令牌, 使用第一个非空的结果
+	// 默认依次尝试 Header 中的 "Bearer <token>" 和原始值
+	Extractors []TokenExtractor
+}
+
+// JWT 令牌校验中间件, 校验通过后可以通过 ctx.Claims、ctx.BindClaims 获取 claims
+// v: claims 类型, 每个请求使用新的实例
+// 校验失败时交由路由的统一错误处理器返回 401
+func JWT(cfg TokenConfig, v interface{}) Handler {
+	if cfg.Header == "" {
+		cfg.Header = TokenHeader
+	}
+	if len(cfg.Extractors) == 0 {
+		cfg.Extractors = []TokenExtractor{FromBearer(cfg.Header), FromHeader(cfg.Header)}
+	}
+	typ := reflect.TypeOf(v)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+
+	return func(ctx *Context) {
+		token := cfg.extract(ctx.r)
+		if token == "" {
+			ctx.w.Header().Set("WWW-Authenticate", "Bearer")
+			ctx.Error(ErrTokenRequired)
+			return
+		}
+
+		claims := reflect.New(typ).Interface().(jwt.Claims)
+		_token, err := parser.ParseWithClaims(token, claims, cfg.Keys.Keyfunc)
+		if err == nil && !_token.Valid {
+			err = ErrInvalidToken
+		}
+		var rc *registered
+		if err == nil {
+			rc, err = cfg.validate(token, time.Now())
+		}
+		if err == nil && rc.Type == TokenTypeRefresh {
+			err = ErrTokenType
+		}
+		if err == nil {
+			err = cfg.checkRevoked(rc)
+		}
+		if err != nil {
+			ctx.w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			ctx.Error(ErrTokenInvalid.WithDetails(err.Error()).WithErr(err))
+			return
+		}
+		ctx.setClaims(_token.Claims, rc)
+	}
+}
+
+// extract 按顺序提取令牌
+func (cfg *TokenConfig) extract(r *http.Request) string {
+	for _, ex := range cfg.Extractors {
+		if token := ex(r); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// setClaims 保存校验通过的 claims, 同时保存到 ctx.GetValue("token") 兼容旧代码
+func (ctx *Context) setClaims(claims jwt.Claims, rc *registered) {
+	ctx.claims = claims
+	ctx.SetPrincipal(&Principal{ID: rc.Subject, Method: AuthJWT})
+	ctx.SetValue("token", claims)
+}
+
+// Claims 返回 JWT 中间件校验通过的 claims, 未校验时为 nil
+func (ctx *Context) Claims() jwt.Claims {
+	return ctx.claims
+}
+
+// Subject 返回认证通过的调用方标识, JWT 认证时为令牌的 sub
+func (ctx *Context) Subject() string {
+	return ctx.subject
+}
+
+// BindClaims 将 claims 赋值给 v 指向的变量, 类型不匹配或未校验时返回 false
+//
+//	var claims *MyClaims
+//	if ctx.BindClaims(&claims) { ... }
+func (ctx *Context) BindClaims(v interface{}) bool {
+	if ctx.claims == nil {
+		return false
+	}
+	dst := reflect.ValueOf(v)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() {
+		return false
+	}
+	dst = dst.Elem()
+	src := reflect.ValueOf(ctx.claims)
+	switch {
+	case src.Type().AssignableTo(dst.Type()):
+		dst.Set(src)
+	case src.Kind() == reflect.Ptr && src.Elem().Type().AssignableTo(dst.Type()):
+		dst.Set(src.Elem())
+	default:
+		return false
+	}
+	return true
+}
+
+// registered 令牌中的注册声明
+type registered struct {
+	Subject   string      `json:"sub"`
+	ExpiresAt *int64      `json:"exp"`
+	NotBefore *int64      `json:"nbf"`
+	IssuedAt  *int64      `json:"iat"`
+	Issuer    string      `json:"iss"`
+	Audience  interface{} `json:"aud"` // 字符串或字符串数组
+	ID        string      `json:"jti"`
+	Family    string      `json:"fam"` // 令牌族, 同一次登录刷新得到的令牌属于同一个令牌族
+	Type      string      `json:"typ"` // 令牌类型
+}
+
+// validate 校验注册声明, 允许 Leeway 的时钟误差
+func (cfg *TokenConfig) validate(token string, now time.Time) (*registered, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	b, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	rc := new(registered)
+	if err = json.Unmarshal(b, rc); err != nil {
+		return nil, err
+	}
+
+	leeway := int64(cfg.Leeway / time.Second)
+	unix := now.Unix()
+	if rc.ExpiresAt != nil && unix > *rc.ExpiresAt+leeway {
+		return nil, ErrTokenExpired
+	}
+	if rc.NotBefore != nil && unix < *rc.NotBefore-leeway {
+		return nil, ErrTokenNotValidYet
+	}
+	if rc.IssuedAt != nil && unix < *rc.IssuedAt-leeway {
+		return nil, ErrTokenUsedBefore
+	}
+	if cfg.Issuer != "" && rc.Issuer != cfg.Issuer {
+		return nil, ErrTokenIssuer
+	}
+	if len(cfg.Audience) > 0 && !matchAudience(rc.Audience, cfg.Audience) {
+		return nil, ErrTokenAudience
+	}
+	return rc, nil
+}
+
+// checkRevoked 检查令牌及其令牌族是否已吊销
+func (cfg *TokenConfig) checkRevoked(rc *registered) error {
+	if cfg.Revocation == nil {
+		return nil
+	}
+	var ids []string
+	if rc.ID != "" {
+		ids = append(ids, rc.ID)
+	}
+	if rc.Family != "" {
+		ids = append(ids, familyKey(rc.Family))
+	}
+	for _, id := range ids {
+		revoked, err := cfg.Revocation.Revoked(id)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+	return nil
+}
+
+// matchAudience aud 中任一值在 want 中即匹配
+func matchAudience(aud interface{}, want []string) bool {
+	var auds []string
+	switch aud := aud.(type) {
+	case string:
+		auds = []string{aud}
+	case []interface{}:
+		for _, val := range aud {
+			if s, ok := val.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+	}
+	for _, a := range auds {
+		for _, w := range want {
+			if a == w {
+				return true
+			}
+		}
+	}
+	return false
+}
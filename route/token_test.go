@@ -0,0 +1,300 @@
+package route_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HiData-xyz/hit/route"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// writePEM 将私钥以 PKCS8 格式写入文件
+func writePEM(path string, key interface{}) {
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	So(err, ShouldBeNil)
+	So(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}), 0644), ShouldBeNil)
+}
+
+// requestWithToken 使用 signer 签发令牌并请求 r
+func requestWithToken(r *route.Route, signer *route.KeySet, claims jwt.Claims) int {
+	token, err := signer.Sign(claims)
+	So(err, ShouldBeNil)
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set(route.TokenHeader, token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestJWT(t *testing.T) {
+	Convey("测试JWT校验", t, func() {
+		dir := t.TempDir()
+		rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+		writePEM(filepath.Join(dir, "rsa.pem"), rsaKey)
+		writePEM(filepath.Join(dir, "ec.pem"), ecKey)
+		jwks, _ := json.Marshal(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "x": base64.RawURLEncoding.EncodeToString(edPub)},
+			},
+		})
+		jwksPath := filepath.Join(dir, "jwks.json")
+		So(ioutil.WriteFile(jwksPath, jwks, 0644), ShouldBeNil)
+
+		verifier := route.NewKeySet()
+		So(verifier.LoadPEM("rsa", filepath.Join(dir, "rsa.pem")), ShouldBeNil)
+		So(verifier.LoadPEM("ec", filepath.Join(dir, "ec.pem")), ShouldBeNil)
+		So(verifier.LoadJWKS(jwksPath), ShouldBeNil)
+
+		r := route.New()
+		r.Get("/me", route.JWT(route.TokenConfig{
+			Keys:     verifier,
+			Issuer:   "hit",
+			Audience: []string{"api"},
+			Leeway:   30 * time.Second,
+		}, &jwt.StandardClaims{}), func(ctx *route.Context) {
+			ctx.JSON(ctx.GetValue("token"))
+		})
+
+		now := time.Now()
+		claims := func() *jwt.StandardClaims {
+			return &jwt.StandardClaims{Issuer: "hit", Audience: "api", ExpiresAt: now.Add(time.Minute).Unix()}
+		}
+		signer := func(kid string, key interface{}) *route.KeySet {
+			ks := route.NewKeySet()
+			k, err := route.NewKey(kid, key)
+			So(err, ShouldBeNil)
+			ks.Add(k)
+			return ks
+		}
+
+		Convey("RS256、ES256、EdDSA", func() {
+			So(requestWithToken(r, signer("rsa", rsaKey), claims()), ShouldEqual, http.StatusOK)
+			So(requestWithToken(r, signer("ec", ecKey), claims()), ShouldEqual, http.StatusOK)
+			So(requestWithToken(r, signer("ed", edKey), claims()), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("kid 与密钥不匹配", func() {
+			So(requestWithToken(r, signer("rsa", ecKey), claims()), ShouldEqual, http.StatusUnauthorized)
+			So(requestWithToken(r, signer("unknown", ecKey), claims()), ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("校验 iss、aud 和时钟误差", func() {
+			c := claims()
+			c.Issuer = "other"
+			So(requestWithToken(r, signer("ec", ecKey), c), ShouldEqual, http.StatusUnauthorized)
+
+			c = claims()
+			c.Audience = "admin"
+			So(requestWithToken(r, signer("ec", ecKey), c), ShouldEqual, http.StatusUnauthorized)
+
+			c = claims()
+			c.ExpiresAt = now.Add(-10 * time.Second).Unix()
+			So(requestWithToken(r, signer("ec", ecKey), c), ShouldEqual, http.StatusOK)
+			c.ExpiresAt = now.Add(-time.Minute).Unix()
+			So(requestWithToken(r, signer("ec", ecKey), c), ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("重新加载密钥", func() {
+			newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			So(requestWithToken(r, signer("ec", newKey), claims()), ShouldEqual, http.StatusUnauthorized)
+			writePEM(filepath.Join(dir, "ec.pem"), newKey)
+			So(verifier.Reload(), ShouldBeNil)
+			So(requestWithToken(r, signer("ec", newKey), claims()), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("兼容 Token 中间件", func() {
+			r := route.New()
+			r.Get("/me", route.Token(route.TokenHeader, "secret", &jwt.StandardClaims{}), func(ctx *route.Context) {
+				ctx.JSON("ok")
+			})
+			So(requestWithToken(r, route.HMACKeySet("secret"), claims()), ShouldEqual, http.StatusOK)
+			So(requestWithToken(r, route.HMACKeySet("other"), claims()), ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+}
+
+func TestRefreshToken(t *testing.T) {
+	Convey("测试刷新令牌", t, func() {
+		path := filepath.Join(t.TempDir(), "revoked.log")
+		store, err := route.NewFileRevocation(path)
+		So(err, ShouldBeNil)
+		defer store.Close()
+
+		iss := &route.TokenIssuer{
+			Keys:      route.HMACKeySet("secret"),
+			Issuer:    "hit",
+			Audience:  []string{"api"},
+			AccessTTL: time.Minute,
+			Store:     store,
+		}
+		r := route.New()
+		r.Post("/login", route.E(func(ctx *route.Context) error {
+			pair, err := ctx.SetTokenPair(iss, "u1", map[string]interface{}{"role": "admin"})
+			if err != nil {
+				return err
+			}
+			return ctx.JSON(pair)
+		}))
+		r.Post("/refresh", route.RefreshToken(iss))
+		r.Get("/me", route.JWT(iss.Config(), &jwt.MapClaims{}), func(ctx *route.Context) {
+			ctx.JSON(ctx.GetValue("token"))
+		})
+
+		call := func(method, path, header, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			if token != "" {
+				req.Header.Set(header, token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+		login := func() *route.TokenPair {
+			w := call(http.MethodPost, "/login", "", "")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			pair := new(route.TokenPair)
+			So(json.Unmarshal(w.Body.Bytes(), pair), ShouldBeNil)
+			return pair
+		}
+		refresh := func(token string) (*route.TokenPair, int) {
+			w := call(http.MethodPost, "/refresh", route.RefreshTokenHeader, token)
+			pair := new(route.TokenPair)
+			json.Unmarshal(w.Body.Bytes(), pair)
+			return pair, w.Code
+		}
+
+		Convey("刷新令牌不能作为访问令牌", func() {
+			pair := login()
+			So(call(http.MethodGet, "/me", route.TokenHeader, pair.AccessToken).Code, ShouldEqual, http.StatusOK)
+			So(call(http.MethodGet, "/me", route.TokenHeader, pair.RefreshToken).Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("刷新后保留自定义声明", func() {
+			pair, code := refresh(login().RefreshToken)
+			So(code, ShouldEqual, http.StatusOK)
+			w := call(http.MethodGet, "/me", route.TokenHeader, pair.AccessToken)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldContainSubstring, `"role":"admin"`)
+		})
+
+		Convey("重复使用刷新令牌时吊销整个令牌族", func() {
+			first := login()
+			second, code := refresh(first.RefreshToken)
+			So(code, ShouldEqual, http.StatusOK)
+
+			_, code = refresh(first.RefreshToken)
+			So(code, ShouldEqual, http.StatusUnauthorized)
+			So(call(http.MethodGet, "/me", route.TokenHeader, second.AccessToken).Code, ShouldEqual, http.StatusUnauthorized)
+			_, code = refresh(second.RefreshToken)
+			So(code, ShouldEqual, http.StatusUnauthorized)
+
+			Convey("吊销记录在重新打开文件后保留", func() {
+				reopened, err := route.NewFileRevocation(path)
+				So(err, ShouldBeNil)
+				defer reopened.Close()
+
+				r := route.New()
+				r.Get("/me", route.JWT(route.TokenConfig{Keys: iss.Keys, Revocation: reopened}, &jwt.MapClaims{}))
+				req := httptest.NewRequest(http.MethodGet, "/me", nil)
+				req.Header.Set(route.TokenHeader, second.AccessToken)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+
+		Convey("退出登录", func() {
+			pair := login()
+			So(iss.Revoke(pair.AccessToken), ShouldBeNil)
+			So(call(http.MethodGet, "/me", route.TokenHeader, pair.AccessToken).Code, ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+}
+
+func TestTokenExtractor(t *testing.T) {
+	Convey("测试令牌提取", t, func() {
+		ks := route.HMACKeySet("secret")
+		token, err := ks.Sign(&jwt.StandardClaims{Subject: "u1", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+		So(err, ShouldBeNil)
+
+		newRoute := func(cfg route.TokenConfig) *route.Route {
+			cfg.Keys = ks
+			r := route.New()
+			r.Get("/me", route.JWT(cfg, &jwt.StandardClaims{}), func(ctx *route.Context) {
+				var claims *jwt.StandardClaims
+				So(ctx.BindClaims(&claims), ShouldBeTrue)
+				So(claims.Subject, ShouldEqual, ctx.Subject())
+				ctx.JSON(ctx.Subject())
+			})
+			return r
+		}
+		do := func(r *route.Route, req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		Convey("默认支持 Bearer 和原始令牌", func() {
+			r := newRoute(route.TokenConfig{})
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := do(r, req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldEqual, `"u1"`)
+
+			req = httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", token)
+			So(do(r, req).Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("按顺序尝试 cookie、URL参数和自定义请求头", func() {
+			r := newRoute(route.TokenConfig{Extractors: []route.TokenExtractor{
+				route.FromCookie("token"), route.FromQuery("access_token"), route.FromHeader("X-Token"),
+			}})
+
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.AddCookie(&http.Cookie{Name: "token", Value: token})
+			So(do(r, req).Code, ShouldEqual, http.StatusOK)
+
+			So(do(r, httptest.NewRequest(http.MethodGet, "/me?access_token="+token, nil)).Code, ShouldEqual, http.StatusOK)
+
+			req = httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("X-Token", token)
+			So(do(r, req).Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("校验失败返回统一错误格式", func() {
+			r := newRoute(route.TokenConfig{})
+			w := do(r, httptest.NewRequest(http.MethodGet, "/me", nil))
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			So(w.Header().Get("WWW-Authenticate"), ShouldEqual, "Bearer")
+
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer invalid")
+			w = do(r, req)
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			var body map[string]interface{}
+			So(json.Unmarshal(w.Body.Bytes(), &body), ShouldBeNil)
+			So(body["msg"], ShouldEqual, route.ErrTokenInvalid.Message)
+			So(body["details"], ShouldNotBeEmpty)
+		})
+	})
+}
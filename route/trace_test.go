@@ -0,0 +1,86 @@
+package route_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	xhttp "github.com/HiData-xyz/hit/http"
+	"github.com/HiData-xyz/hit/pool"
+	"github.com/HiData-xyz/hit/route"
+	"github.com/HiData-xyz/hit/trace"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTrace(t *testing.T) {
+	Convey("测试链路追踪", t, func() {
+		exp := trace.NewMemoryExporter()
+		trace.SetExporter(exp)
+		defer trace.SetExporter(nil)
+
+		parents := make(chan string, 4)
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parents <- r.Header.Get(trace.TraceparentHeader)
+			w.Write([]byte(`{}`))
+		}))
+		defer backend.Close()
+
+		done := make(chan struct{})
+		r := route.New()
+		r.Get("/order", func(ctx *route.Context) {
+			var res map[string]interface{}
+			if err := xhttp.GetContext(ctx.Context(), backend.URL+"/stock", &res); err != nil {
+				ctx.Error(err)
+				return
+			}
+			ctx.SetHook(backend.URL+"/hook", map[string]int{"id": 1})
+			pool.PushContext(ctx.Context(), "task", func(context.Context) { close(done) })
+			ctx.JSON("ok")
+		})
+
+		const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		req := httptest.NewRequest(http.MethodGet, "/order", nil)
+		req.Header.Set(trace.TraceparentHeader, incoming)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case tp := <-parents:
+				sc, err := trace.ParseTraceparent(tp)
+				So(err, ShouldBeNil)
+				So(sc.TraceID.String(), ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+			case <-time.After(3 * time.Second):
+				So("请求超时", ShouldBeEmpty)
+			}
+		}
+		<-done
+
+		spans := make(map[string]*trace.Span)
+		deadline := time.Now().Add(3 * time.Second)
+		for len(spans) < 4 && time.Now().Before(deadline) {
+			for _, s := range exp.Spans() {
+				spans[s.Name] = s
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		server := spans["GET /order"]
+		So(server, ShouldNotBeNil)
+		So(server.Kind, ShouldEqual, trace.KindServer)
+		So(server.TraceID, ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+		So(server.ParentID, ShouldEqual, "00f067aa0ba902b7")
+		So(server.Attributes["http.status_code"], ShouldEqual, http.StatusOK)
+
+		for _, name := range []string{"HTTP GET", "hook POST", "task"} {
+			So(spans[name], ShouldNotBeNil)
+			So(spans[name].TraceID, ShouldEqual, server.TraceID)
+			So(spans[name].ParentID, ShouldEqual, server.SpanID)
+		}
+		So(spans["HTTP GET"].Attributes["http.status_code"], ShouldEqual, http.StatusOK)
+	})
+}
@@ -19,31 +19,44 @@ type tree struct {
 
 func (t *tree) Add(path string, method string, h Handles) {
 	var paths []string
-	for _, val := range strings.Split(strings.ToUpper(path), "/") {
+	for _, val := range strings.Split(path, "/") {
 		if val == "" {
 			continue
 		}
 		paths = append(paths, val)
 	}
+	pattern := "/" + strings.Join(paths, "/")
+	for i := range paths {
+		paths[i] = strings.ToUpper(paths[i])
+	}
 	method = strings.ToUpper(method)
-	t.add(paths, HTTPMethod(method), h)
+	t.add(paths, HTTPMethod(method), pattern, h)
 }
 
-func (t *tree) add(path []string, method HTTPMethod, h Handles) {
+func (t *tree) add(path []string, method HTTPMethod, pattern string, h Handles) {
 	if len(path) == 0 {
 		if t.node == nil {
 			t.node = new(node)
 		}
+		if t.node.pattern == "" {
+			t.node.pattern = pattern
+		}
 		t.node.add(method, h)
 		return
 	}
 	if t.children[path[0]] == nil {
 		t.children[path[0]] = newTree()
 	}
-	t.children[path[0]].add(path[1:], method, h)
+	t.children[path[0]].add(path[1:], method, pattern, h)
 }
 
 func (t *tree) Find(path, method string) (h Handles) {
+	h, _ = t.lookup(path, method)
+	return
+}
+
+// lookup 查找路由的处理方法和注册时的路径, 用于按路由统计指标
+func (t *tree) lookup(path, method string) (h Handles, pattern string) {
 	var paths []string
 	for _, val := range strings.Split(strings.ToUpper(path), "/") {
 		if val == "" {
@@ -55,9 +68,9 @@ func (t *tree) Find(path, method string) (h Handles) {
 	return t.find(paths, method)
 }
 
-func (t *tree) find(path []string, method HTTPMethod) (h Handles) {
+func (t *tree) find(path []string, method HTTPMethod) (h Handles, pattern string) {
 	if len(path) == 0 {
-		return t.node.get(method)
+		return t.node.get(method), t.node.pattern
 	}
 	child := t.children[path[0]]
 	if child == nil {
@@ -77,6 +90,8 @@ const (
 )
 
 type node struct {
+	pattern string // 注册时的路径
+
 	// 实现REST请求
 	postHandels Handles // Post请求处理方法
 	getHandels  Handles // Get请求处理方法
@@ -0,0 +1,166 @@
+package route
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"net"
+	"net/http"
+)
+
+// statusWriter 记录写入的状态码, 保留 http.Flusher、http.Hijacker 接口
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 实现 http.Flusher 接口
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 实现 http.Hijacker 接口
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+// Status 返回写入的状态码, 未写入时为 200
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// captureWriter 在写入响应的同时记录状态码和 body, body 超过 limit 后不再记录, 只记录长度和摘要
+type captureWriter struct {
+	http.ResponseWriter
+
+	status   int
+	body     bytes.Buffer
+	limit    int64
+	overflow bool      // body 是否超过 limit
+	size     int64     // body 的长度
+	sum      hash.Hash // 超过 limit 后 body 的 SHA-256 摘要
+}
+
+func newCaptureWriter(w http.ResponseWriter, limit int64) *captureWriter {
+	return &captureWriter{ResponseWriter: w, limit: limit}
+}
+
+func (w *captureWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.size += int64(len(b))
+	switch {
+	case w.overflow:
+		w.sum.Write(b)
+	case w.size > w.limit:
+		w.overflow = true
+		w.sum = sha256.New()
+		w.sum.Write(w.body.Bytes())
+		w.sum.Write(b)
+		w.body.Reset()
+	default:
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// sameBody 两个响应的 body 是否一致, 超过 limit 时比较长度和摘要
+func (w *captureWriter) sameBody(o *captureWriter) bool {
+	if w.size != o.size || w.overflow != o.overflow {
+		return false
+	}
+	if w.overflow {
+		return bytes.Equal(w.sum.Sum(nil), o.sum.Sum(nil))
+	}
+	return bytes.Equal(w.body.Bytes(), o.body.Bytes())
+}
+
+// Flush 实现 http.Flusher 接口
+func (w *captureWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Status 返回写入的状态码, 未写入时为 200
+func (w *captureWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// discardWriter 丢弃写入的响应
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) WriteHeader(code int) {}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// bufferWriter 只在内存中记录响应, 不写入网络
+type bufferWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferWriter() *bufferWriter {
+	return &bufferWriter{header: make(http.Header)}
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
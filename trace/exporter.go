@@ -0,0 +1,102 @@
+package trace
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Exporter 导出结束的 Span
+type Exporter interface {
+	Export(s *Span)
+}
+
+var (
+	exporterMu sync.RWMutex
+	exporter   Exporter
+)
+
+// SetExporter 设置全局的 Exporter, 为空时不导出
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+func getExporter() Exporter {
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+	return exporter
+}
+
+// FileExporter 将 Span 以 JSON lines 格式追加写入文件
+type FileExporter struct {
+	m   sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewFileExporter 打开 path 文件追加写入
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Export 实现 Exporter
+func (e *FileExporter) Export(s *Span) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.f == nil {
+		return
+	}
+	e.enc.Encode(s)
+}
+
+// Close 关闭文件
+func (e *FileExporter) Close() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.f == nil {
+		return nil
+	}
+	err := e.f.Close()
+	e.f = nil
+	return err
+}
+
+// MemoryExporter 在内存中保存 Span, 用于测试
+type MemoryExporter struct {
+	m     sync.Mutex
+	spans []*Span
+}
+
+// NewMemoryExporter 返回内存 Exporter
+func NewMemoryExporter() *MemoryExporter {
+	return new(MemoryExporter)
+}
+
+// Export 实现 Exporter
+func (e *MemoryExporter) Export(s *Span) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Spans 返回已导出的 Span
+func (e *MemoryExporter) Spans() []*Span {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset 清空已导出的 Span
+func (e *MemoryExporter) Reset() {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.spans = nil
+}
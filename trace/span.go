@@ -0,0 +1,140 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Kind Span 的类型
+type Kind string
+
+// Span 类型
+const (
+	KindServer   Kind = "server"   // 处理收到的请求
+	KindClient   Kind = "client"   // 发送请求
+	KindInternal Kind = "internal" // 进程内的操作, 如协程池任务
+)
+
+// Span 链路中的一次操作
+type Span struct {
+	Name       string                 `json:"name"`
+	Kind       Kind                   `json:"kind"`
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	StartTime  time.Time              `json:"start_time"`
+	EndTime    time.Time              `json:"end_time"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+
+	m     sync.Mutex
+	sc    SpanContext
+	ended bool
+}
+
+// Context 返回 Span 的追踪上下文, 用于传递给下游服务
+func (s *Span) Context() SpanContext {
+	return s.sc
+}
+
+// SetAttribute 设置属性
+func (s *Span) SetAttribute(key string, val interface{}) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]interface{})
+	}
+	s.Attributes[key] = val
+}
+
+// SetError 记录错误, err 为空时忽略
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.Error = err.Error()
+}
+
+// End 结束 Span, 采样的 Span 交由 Exporter 导出, 重复调用无效
+func (s *Span) End() {
+	s.m.Lock()
+	if s.ended {
+		s.m.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.m.Unlock()
+
+	if !s.sc.Sampled() {
+		return
+	}
+	if e := getExporter(); e != nil {
+		e.Export(s)
+	}
+}
+
+// Duration 返回 Span 的耗时, 未结束时为 0
+func (s *Span) Duration() time.Duration {
+	if s.EndTime.IsZero() {
+		return 0
+	}
+	return s.EndTime.Sub(s.StartTime)
+}
+
+type spanKey struct{}
+
+// ContextWithSpan 返回保存 Span 的 context, 之后创建的 Span 作为它的子 Span
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// ContextWithRemote 返回保存上游服务追踪上下文的 context
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// SpanFromContext 返回 context 中的 Span, 没有时返回 nil
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext 返回 context 中的追踪上下文, 包括上游服务的追踪上下文
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if ctx == nil {
+		return SpanContext{}, false
+	}
+	switch v := ctx.Value(spanKey{}).(type) {
+	case *Span:
+		return v.sc, true
+	case SpanContext:
+		return v, v.IsValid()
+	}
+	return SpanContext{}, false
+}
+
+// Start 创建 Span 并返回保存该 Span 的 context
+// ctx 中有追踪上下文时创建子 Span, 沿用追踪ID、采样标记和 tracestate, 否则开始新的链路
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := &Span{Name: name, Kind: kind, StartTime: time.Now()}
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		s.sc = SpanContext{TraceID: parent.TraceID, Flags: parent.Flags, State: parent.State}
+		s.ParentID = parent.SpanID.String()
+	} else {
+		s.sc = SpanContext{TraceID: newTraceID(), Flags: FlagSampled}
+	}
+	s.sc.SpanID = newSpanID()
+	s.TraceID = s.sc.TraceID.String()
+	s.SpanID = s.sc.SpanID.String()
+	return ContextWithSpan(ctx, s), s
+}
@@ -0,0 +1,155 @@
+// Package trace 实现 W3C Trace Context 的链路追踪
+//
+// 通过 traceparent、tracestate 请求头在服务之间传递追踪上下文,
+// 路由、http 客户端、回调和协程池任务会创建对应的 Span, 由 Exporter 导出
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context 请求头
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// ErrInvalidTraceparent 无效的 traceparent
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// FlagSampled 采样标记
+const FlagSampled byte = 0x01
+
+// TraceID 追踪ID, 同一条链路中的 Span 使用相同的追踪ID
+type TraceID [16]byte
+
+// SpanID Span 的ID
+type SpanID [8]byte
+
+// String 返回十六进制表示
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid 全为 0 时无效
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// String 返回十六进制表示
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid 全为 0 时无效
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext 在服务之间传递的追踪上下文
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	State   string // tracestate, 原样传递
+}
+
+// IsValid 追踪ID和 Span ID 是否有效
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Sampled 是否采样, 未采样的 Span 不导出
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent 返回 traceparent 请求头的值
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent 解析 traceparent, 格式: version-traceid-spanid-flags
+// 高于 00 的版本只解析前四个字段
+func ParseTraceparent(val string) (sc SpanContext, err error) {
+	val = strings.TrimSpace(val)
+	if len(val) < 55 || (len(val) > 55 && val[55] != '-') {
+		return sc, ErrInvalidTraceparent
+	}
+	if val[2] != '-' || val[35] != '-' || val[52] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+	version, err := decodeHex(val[:2])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(val) != 55) {
+		return sc, ErrInvalidTraceparent
+	}
+
+	traceID, err := decodeHex(val[3:35])
+	if err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	spanID, err := decodeHex(val[36:52])
+	if err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	flags, err := decodeHex(val[53:55])
+	if err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// decodeHex 只接受小写的十六进制
+func decodeHex(s string) ([]byte, error) {
+	if strings.ToLower(s) != s {
+		return nil, ErrInvalidTraceparent
+	}
+	return hex.DecodeString(s)
+}
+
+// Extract 从请求头中读取追踪上下文
+func Extract(h http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.State = strings.Join(h.Values(TracestateHeader), ",")
+	return sc, true
+}
+
+// Inject 将追踪上下文写入请求头
+func Inject(h http.Header, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.State != "" {
+		h.Set(TracestateHeader, sc.State)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return
+}
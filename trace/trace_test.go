@@ -0,0 +1,129 @@
+package trace_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HiData-xyz/hit/trace"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTraceparent(t *testing.T) {
+	Convey("测试 traceparent 解析", t, func() {
+		const val = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		sc, err := trace.ParseTraceparent(val)
+		So(err, ShouldBeNil)
+		So(sc.TraceID.String(), ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+		So(sc.SpanID.String(), ShouldEqual, "00f067aa0ba902b7")
+		So(sc.Sampled(), ShouldBeTrue)
+		So(sc.Traceparent(), ShouldEqual, val)
+
+		_, err = trace.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+		So(err, ShouldBeNil)
+
+		for _, val := range []string{
+			"",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		} {
+			_, err := trace.ParseTraceparent(val)
+			So(err, ShouldEqual, trace.ErrInvalidTraceparent)
+		}
+	})
+
+	Convey("测试请求头传递", t, func() {
+		h := make(http.Header)
+		h.Set(trace.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		h.Add(trace.TracestateHeader, "a=1")
+		h.Add(trace.TracestateHeader, "b=2")
+		sc, ok := trace.Extract(h)
+		So(ok, ShouldBeTrue)
+		So(sc.Sampled(), ShouldBeFalse)
+		So(sc.State, ShouldEqual, "a=1,b=2")
+
+		out := make(http.Header)
+		trace.Inject(out, sc)
+		So(out.Get(trace.TraceparentHeader), ShouldEqual, h.Get(trace.TraceparentHeader))
+		So(out.Get(trace.TracestateHeader), ShouldEqual, "a=1,b=2")
+
+		_, ok = trace.Extract(make(http.Header))
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestSpan(t *testing.T) {
+	Convey("测试 Span", t, func() {
+		exp := trace.NewMemoryExporter()
+		trace.SetExporter(exp)
+		defer trace.SetExporter(nil)
+
+		Convey("父子关系", func() {
+			ctx, root := trace.Start(context.Background(), "root", trace.KindServer)
+			_, child := trace.Start(ctx, "child", trace.KindClient)
+			child.SetAttribute("k", "v")
+			child.SetError(errors.New("failed"))
+			child.End()
+			child.End()
+			root.End()
+
+			spans := exp.Spans()
+			So(spans, ShouldHaveLength, 2)
+			So(spans[0].Name, ShouldEqual, "child")
+			So(spans[0].TraceID, ShouldEqual, root.TraceID)
+			So(spans[0].ParentID, ShouldEqual, root.SpanID)
+			So(spans[0].Error, ShouldEqual, "failed")
+			So(spans[0].Attributes["k"], ShouldEqual, "v")
+			So(spans[1].ParentID, ShouldBeEmpty)
+			So(root.Duration(), ShouldBeGreaterThanOrEqualTo, child.Duration())
+		})
+
+		Convey("沿用上游的追踪上下文, 未采样时不导出", func() {
+			sc, _ := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+			sc.State = "a=1"
+			_, span := trace.Start(trace.ContextWithRemote(context.Background(), sc), "server", trace.KindServer)
+			So(span.TraceID, ShouldEqual, sc.TraceID.String())
+			So(span.ParentID, ShouldEqual, sc.SpanID.String())
+			So(span.Context().State, ShouldEqual, "a=1")
+			span.End()
+			So(exp.Spans(), ShouldBeEmpty)
+		})
+	})
+
+	Convey("测试文件导出", t, func() {
+		path := filepath.Join(t.TempDir(), "spans.jsonl")
+		exp, err := trace.NewFileExporter(path)
+		So(err, ShouldBeNil)
+		trace.SetExporter(exp)
+		defer trace.SetExporter(nil)
+
+		for _, name := range []string{"a", "b"} {
+			_, span := trace.Start(context.Background(), name, trace.KindInternal)
+			span.End()
+		}
+		So(exp.Close(), ShouldBeNil)
+
+		f, err := os.Open(path)
+		So(err, ShouldBeNil)
+		defer f.Close()
+		var names []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var span trace.Span
+			So(json.Unmarshal(scanner.Bytes(), &span), ShouldBeNil)
+			So(span.TraceID, ShouldHaveLength, 32)
+			names = append(names, span.Name)
+		}
+		So(names, ShouldResemble, []string{"a", "b"})
+	})
+}
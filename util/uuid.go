@@ -1,12 +1,25 @@
 package util
 
 import (
+	"os"
 	"strconv"
 
 	"github.com/sony/sonyflake"
 )
 
-var flake = sonyflake.NewSonyflake(sonyflake.Settings{})
+var flake = newFlake()
+
+// newFlake 默认使用私有IP生成机器ID, 没有私有IP时使用进程号
+func newFlake() *sonyflake.Sonyflake {
+	if f := sonyflake.NewSonyflake(sonyflake.Settings{}); f != nil {
+		return f
+	}
+	return sonyflake.NewSonyflake(sonyflake.Settings{
+		MachineID: func() (uint16, error) {
+			return uint16(os.Getpid()), nil
+		},
+	})
+}
 
 // UUID 唯一ID
 func UUID() string {